@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"os"
+
+	"github.com/kweheliye/json2parquet/internal/parse"
 	"github.com/kweheliye/json2parquet/internal/pipeline"
 	"github.com/kweheliye/json2parquet/utils"
 	"github.com/spf13/cobra"
@@ -8,6 +11,10 @@ import (
 
 var (
 	genericConfigFile string
+	genericDryRun     bool
+	genericLimit      int
+	genericRows       int
+	genericFormat     string
 )
 
 var genericCmd = &cobra.Command{
@@ -21,8 +28,13 @@ The configuration file defines:
 - Nested structure navigation
 - Parent-child relationships
 
+With --dry-run (plan mode) nothing is written: the tables are evaluated against the first
+--limit root records, and the resolved schema and --rows sample rows of every table are
+printed together with the configured paths that never matched.
+
 Example:
-  json2parquet generic --config parse_config.yaml`,
+  json2parquet generic --config parse_config.yaml
+  json2parquet generic --config parse_config.yaml --dry-run --limit 50 --format json`,
 	Run: func(cmd *cobra.Command, args []string) {
 		runGenericParse()
 	},
@@ -31,10 +43,18 @@ Example:
 func init() {
 
 	genericCmd.Flags().StringVarP(&genericConfigFile, "config", "c", "parse_config.yaml", "Path to parse configuration file")
+	genericCmd.Flags().BoolVar(&genericDryRun, "dry-run", false, "Preview the tables instead of writing Parquet files")
+	genericCmd.Flags().IntVarP(&genericLimit, "limit", "n", 100, "Root records read by --dry-run (0 reads every record)")
+	genericCmd.Flags().IntVar(&genericRows, "rows", 5, "Sample rows printed per table by --dry-run")
+	genericCmd.Flags().StringVar(&genericFormat, "format", "table", "Output of --dry-run: table or json")
 }
 
 func runGenericParse() {
 	log := utils.GetLogger()
+	if genericDryRun {
+		runGenericPlan()
+		return
+	}
 	log.Infof("Starting generic JSON to Parquet conversion")
 	log.Infof("Configuration file: %s", genericConfigFile)
 
@@ -47,3 +67,19 @@ func runGenericParse() {
 
 	log.Infof("Generic parsing completed successfully")
 }
+
+func runGenericPlan() {
+	log := utils.GetLogger()
+	// Keep stdout for the plan
+	log.SetOutput(os.Stderr)
+	log.Infof("Starting dry run of configuration file: %s", genericConfigFile)
+
+	p, err := pipeline.NewGenericPlanPipeline(genericConfigFile, parse.PlanOptions{
+		Limit:      genericLimit,
+		SampleRows: genericRows,
+	}, genericFormat, os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to build generic pipeline: %v", err)
+	}
+	p.Run()
+}
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/kweheliye/json2parquet/internal/parse"
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/kweheliye/json2parquet/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	inferOutput      string
+	inferLimit       int
+	inferRootArray   string
+	inferFormat      string
+	inferCompression string
+	inferTableName   string
+	inferExamples    int
+)
+
+var inferCmd = &cobra.Command{
+	Use:   "infer <sample.json>",
+	Short: "Generate a parse configuration from a sample JSON file",
+	Long: `Scan a sample JSON or NDJSON file (streaming, optionally only the first records) and
+print a parse configuration for it.
+
+The generated configuration contains:
+- One table per array-of-objects location, nested under its parent table
+- Column types inferred from the values, widened when they disagree
+- required flags for fields set in every sampled row
+- parent_refs to the unique ID fields of ancestor tables
+- Row counts and example values as comments
+
+Example:
+  json2parquet infer data/nested_20.json --limit 1000 -o parse_config.yaml`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		runInfer(args[0])
+	},
+}
+
+func init() {
+	inferCmd.Flags().StringVarP(&inferOutput, "output", "o", "", "Write the configuration to this file instead of stdout")
+	inferCmd.Flags().IntVarP(&inferLimit, "limit", "n", 0, "Root records to scan (0 scans the whole file)")
+	inferCmd.Flags().StringVar(&inferRootArray, "root-array", "", "Dot-separated key of the array holding the root records")
+	inferCmd.Flags().StringVar(&inferFormat, "format", "", "json or ndjson; detected from the extension when empty")
+	inferCmd.Flags().StringVar(&inferCompression, "compression", "", "gzip, zstd, bzip2, xz or none; detected from the extension when empty")
+	inferCmd.Flags().StringVar(&inferTableName, "table", "", "Name of the root table (defaults to the file name)")
+	inferCmd.Flags().IntVar(&inferExamples, "examples", 3, "Example values shown per column")
+}
+
+func runInfer(samplePath string) {
+	log := utils.GetLogger()
+
+	out, err := parse.InferConfig(samplePath, parse.InferOptions{
+		Source: models.SourceConfig{
+			RootArray:   inferRootArray,
+			Format:      inferFormat,
+			Compression: inferCompression,
+		},
+		Limit:     inferLimit,
+		TableName: inferTableName,
+		Examples:  inferExamples,
+	})
+	if err != nil {
+		log.Fatalf("Failed to infer configuration: %v", err)
+	}
+
+	if inferOutput == "" {
+		os.Stdout.Write(out)
+		return
+	}
+	if err := os.WriteFile(inferOutput, out, 0o644); err != nil {
+		log.Fatalf("Failed to write %s: %v", inferOutput, err)
+	}
+	log.Infof("Wrote inferred configuration to %s", inferOutput)
+}
@@ -4,7 +4,13 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/kweheliye/json2parquet/utils"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	appConfigFile string
 )
 
 var rootCmd = &cobra.Command{
@@ -14,7 +20,32 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
+	cobra.OnInitialize(initAppConfig)
+
+	rootCmd.PersistentFlags().StringVar(&appConfigFile, "app-config", "config.yaml", "Path to application settings (log level, writer defaults, timeouts)")
+
 	rootCmd.AddCommand(genericCmd)
+	rootCmd.AddCommand(inferCmd)
+	rootCmd.AddCommand(validateCmd)
+}
+
+// initAppConfig loads application settings into viper; a missing file is not an error
+func initAppConfig() {
+	if appConfigFile == "" {
+		return
+	}
+	if _, err := os.Stat(appConfigFile); err != nil {
+		return
+	}
+
+	viper.SetConfigFile(appConfigFile)
+	if err := viper.ReadInConfig(); err != nil {
+		fmt.Printf("failed to read application config %s: %v\n", appConfigFile, err)
+		os.Exit(1)
+	}
+
+	// refresh the shared logger now that log.level is known
+	utils.GetLogger()
 }
 
 func Execute() {
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kweheliye/json2parquet/internal/parse"
+	"github.com/kweheliye/json2parquet/utils"
+	"github.com/spf13/cobra"
+)
+
+var (
+	validateConfigFile string
+	validateSample     string
+	validateLimit      int
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check a parse configuration and report every problem found",
+	Long: `Check a parse configuration without converting anything. Problems are printed one per
+line as file:line:column: severity: setting: message.
+
+Errors include:
+- Unknown keys and values of the wrong type
+- Unknown column types and invalid type options
+- Missing or duplicate table names and aliases, unknown parent and entity_name references
+- parent_refs naming a table that does not enclose the referencing table
+- Column names used twice in a table, including generated columns
+- Invalid JSONPath expressions
+
+With --sample the configuration is also run on the first records of a sample file, and
+tables matching no rows and fields never holding a value are reported as warnings.
+The command exits with status 1 when any error is found.
+
+Example:
+  json2parquet validate --config parse_config.yaml --sample data/nested_20.json --limit 100`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runValidate()
+	},
+}
+
+func init() {
+	validateCmd.Flags().StringVarP(&validateConfigFile, "config", "c", "parse_config.yaml", "Path to parse configuration file")
+	validateCmd.Flags().StringVar(&validateSample, "sample", "", "JSON or NDJSON file to try the configuration on")
+	validateCmd.Flags().IntVarP(&validateLimit, "limit", "n", 1000, "Root records read from the sample (0 reads the whole file)")
+}
+
+func runValidate() {
+	log := utils.GetLogger()
+
+	diagnostics, err := parse.ValidateConfigFile(validateConfigFile, parse.ValidateOptions{
+		Sample: validateSample,
+		Limit:  validateLimit,
+	})
+	for _, d := range diagnostics {
+		fmt.Println(d.String())
+	}
+	if err != nil {
+		log.Fatalf("Failed to validate configuration: %v", err)
+	}
+	if parse.HasErrors(diagnostics) {
+		os.Exit(1)
+	}
+	if len(diagnostics) == 0 {
+		fmt.Printf("%s: ok\n", validateConfigFile)
+	}
+}
@@ -0,0 +1,120 @@
+// Package expr compiles and evaluates the expressions of computed columns, e.g.
+// concat(first, ' ', last), coalesce(a.b, c), price * quantity or date_add(created, 7, 'day'),
+// and the where predicates of tables, e.g. status in ['open', 'new'] && name =~ /^a/i.
+//
+// Names read from the current object as JSONPath expressions (see internal/jsonpath); a leading
+// name declared as a variable reads from the object bound to it instead, and $ reads the root.
+// Expressions are type checked when compiled: values read from the JSON have type Any and are
+// converted when evaluated, everything else has a static type.
+package expr
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Type is the static type of an expression
+type Type int
+
+const (
+	Any    Type = iota // Known when evaluated, e.g. a value read from the JSON
+	Null               // The null literal
+	Bool               // true or false
+	Number             // int64 or float64
+	String             // Text
+	Time               // time.Time
+)
+
+// String returns the name used in error messages
+func (t Type) String() string {
+	switch t {
+	case Null:
+		return "null"
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Time:
+		return "time"
+	}
+	return "any"
+}
+
+// Expr is a compiled expression
+type Expr struct {
+	src  string
+	root node
+	keys []string
+}
+
+// Env holds the values an expression reads from: the current object, the root record and
+// the objects bound to variables
+type Env struct {
+	Current interface{}
+	Root    interface{}
+	Vars    map[string]interface{}
+}
+
+// Compile parses and type checks an expression. vars lists the names that read from the
+// objects bound to them in Env.Vars rather than from the current object.
+func Compile(src string, vars []string) (*Expr, error) {
+	p := &parser{src: src, vars: make(map[string]bool, len(vars))}
+	for _, name := range vars {
+		p.vars[name] = true
+	}
+
+	root, err := p.parse()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	return &Expr{src: src, root: root, keys: p.keys}, nil
+}
+
+// FormatNumber writes an exact number result in full when its decimal expansion is finite,
+// and as the nearest float64 otherwise
+func FormatNumber(r *big.Rat) string {
+	return formatNumber(r)
+}
+
+// String returns the source of the expression
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Type returns the static type of the expression's result
+func (e *Expr) Type() Type {
+	return e.root.typ()
+}
+
+// Keys returns the members of the current object the expression reads
+func (e *Expr) Keys() []string {
+	return e.keys
+}
+
+// Eval evaluates the expression. The result is nil, a bool, a number (an int64, an exact
+// *big.Rat or a float64), a string, a time.Time, or a value read from the JSON as is.
+func (e *Expr) Eval(env Env) (interface{}, error) {
+	return e.root.eval(&env)
+}
+
+// Test evaluates the expression as a condition: null is false, and any other value that is
+// not a bool is an error
+func (e *Expr) Test(env Env) (bool, error) {
+	return evalBool(e.root, &env, e.src)
+}
+
+// Error is an evaluation error, located at the part of the expression that failed
+type Error struct {
+	Expr string // Source of the failing part, e.g. lower(email)
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Expr, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
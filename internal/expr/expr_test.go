@@ -0,0 +1,252 @@
+package expr
+
+import (
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testRow is the current object of the evaluation tests
+var testRow = map[string]interface{}{
+	"first":  "Ada",
+	"last":   "Lovelace",
+	"price":  json.Number("19.99"),
+	"qty":    json.Number("3"),
+	"big":    json.Number("12345678901234567"),
+	"max":    json.Number("9223372036854775807"),
+	"quoted": "42",
+	"active": true,
+	"note":   nil,
+	"tags":   []interface{}{"a", "b", "c"},
+	"owner":  map[string]interface{}{"name": "grace"},
+	"since":  "2024-01-31",
+}
+
+func eval(t *testing.T, src string) (interface{}, error) {
+	t.Helper()
+	e, err := Compile(src, []string{"project"})
+	if err != nil {
+		t.Fatalf("Compile(%q): %v", src, err)
+	}
+	return e.Eval(Env{
+		Current: testRow,
+		Root:    map[string]interface{}{"batch": "b1"},
+		Vars:    map[string]interface{}{"project": map[string]interface{}{"id": json.Number("7")}},
+	})
+}
+
+// text renders a result for comparison; exact numbers as their decimal text
+func text(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case *big.Rat:
+		return "rat:" + formatNumber(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	}
+	s, err := toText(v)
+	if err != nil {
+		return err.Error()
+	}
+	return s
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		// Literals and paths
+		{`'it\'s'`, "it's"},
+		{`"double"`, "double"},
+		{"owner.name", "grace"},
+		{"tags[1]", "b"},
+		{"$.batch", "b1"},
+		{"project.id", "7"},
+		{"missing", "null"},
+
+		// Precedence and associativity
+		{"1 + 2 * 3", "7"},
+		{"(1 + 2) * 3", "9"},
+		{"10 - 4 - 3", "3"},
+		{"2 * 3 % 4", "2"},
+		{"-2 * 3", "-6"},
+		{"1 + 2 == 3 && 2 < 1 || true", "true"},
+		{"!false && false", "false"},
+		{"not true or true", "true"},
+		{"(1 < 2) == true", "true"},
+
+		// Strings, slices and functions
+		{"first + ' ' + last", "Ada Lovelace"},
+		{"concat(first, ' ', note, last)", "Ada Lovelace"},
+		{"first[0:1] + last[-4:]", "Alace"},
+		{"tags[1:]", `["b","c"]`},
+		{"upper(substr(last, 0, 4))", "LOVE"},
+		{"length(tags)", "3"},
+		{"if(active, 'on', 'off')", "on"},
+		{"coalesce(note, missing, owner.name)", "grace"},
+		{"to_number(quoted) + 1", "43"},
+		{"to_number('42')", "42"},
+		{"date_add(since, 1, 'month')", "2024-02-29T00:00:00Z"},
+		{"date_diff(to_time('2024-03-01'), since, 'day')", "30"},
+
+		// Nulls propagate through arithmetic and functions, compare equal only to null
+		{"note + 1", "null"},
+		{"-note", "null"},
+		{"lower(note)", "null"},
+		{"note == null", "true"},
+		{"note != 1", "true"},
+		{"note < 1", "false"},
+		{"if(note, 'yes', 'no')", "no"},
+		{"note && true", "false"},
+
+		// Lists, regular expressions and null checks
+		{"first in ['Ada', 'Bob']", "true"},
+		{"qty not in (1, 2, 3)", "false"},
+		{"project.id in [6 + 1] and owner.name is not null", "true"},
+		{"not (first in ['Ada'])", "false"},
+		{"note in [null]", "true"},
+		{"first =~ /^a/i", "true"},
+		{"last !~ 'love'", "true"},
+		{`price =~ /^19\.9/`, "true"},
+		{"note =~ /./", "false"},
+		{"note is null && missing is null", "true"},
+		{"first is not null", "true"},
+
+		// Exact numbers
+		{"price * qty", "rat:59.97"},
+		{"0.1 + 0.2 == 0.3", "true"},
+		{"big / 10", "rat:1234567890123456.7"},
+		{"10 / 4", "rat:2.5"},
+		{"10 / 2", "5"},
+		{"1 / 3 * 3", "1"},
+		{"7.5 % 2", "rat:1.5"},
+		{"-7 % 3", "-1"},
+		{"max + 1", "rat:9223372036854775808"},
+		{"-max - 2", "rat:-9223372036854775809"},
+		{"max * 2 / 2", "9223372036854775807"},
+		{"4611686018427387904 * 2", "rat:9223372036854775808"},
+		{"round(1.005, 2)", "rat:1.01"},
+		{"round(-2.5)", "-3"},
+		{"round(1250, -2)", "1300"},
+		{"floor(-1.5)", "-2"},
+		{"ceil(-1.5)", "-1"},
+		{"abs(-max - 1)", "rat:9223372036854775808"},
+		{"to_string(1 / 8)", "0.125"},
+		{"to_string(1 / 3)", "0.3333333333333333"},
+		{"big > 12345678901234566.5", "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := eval(t, tt.src)
+			if err != nil {
+				t.Fatalf("Eval: %v", err)
+			}
+			if s := text(got); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // Substring of the error
+	}{
+		{"1 / 0", "1 / 0: division by zero"},
+		{"price % 0", "division by zero"},
+		{"to_number(first)", `expected a number, got string "Ada"`},
+		{"first * 2", `first * 2: expected a number, got string "Ada"`},
+		{"substr(last, 0.5)", "expected a whole number"},
+		{"tags < 1", "cannot order array and number 1"},
+		{"if(first, 1, 2)", "expected a bool"},
+		{"first && true", "expected a bool"},
+		{"tags =~ /a/", "tags =~ /a/: cannot match array"},
+		{"date_add(since, max + 1, 'day')", "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			_, err := eval(t, tt.src)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Eval error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		src     string
+		typ     Type
+		wantErr string // Substring of the error, empty when the expression compiles
+	}{
+		{src: "price * qty", typ: Number},
+		{src: "concat(first, last)", typ: String},
+		{src: "price > 1 && active", typ: Bool},
+		{src: "date_add(since, 1, 'day')", typ: Time},
+		{src: "coalesce(2, 1)", typ: Number},
+		{src: "coalesce(note, 1)", typ: Any},
+		{src: "note", typ: Any},
+		{src: "note is not null", typ: Bool},
+		{src: "first in ['a', 'b'] or last =~ /x/", typ: Bool},
+		{src: "to_number('42')", typ: Number},
+		{src: "null", typ: Null},
+
+		// Syntax errors are located
+		{src: "1 +", wantErr: "offset 3"},
+		{src: "(1 + 2", wantErr: "offset"},
+		{src: "lower(first", wantErr: "offset"},
+		{src: "'open", wantErr: "offset"},
+		{src: "1 2", wantErr: "offset 2"},
+		{src: "and", wantErr: `found "and"`},
+		{src: "is null", wantErr: `found "is"`},
+		{src: "first in 'a'", wantErr: "expected a list after in"},
+		{src: "first not 'a'", wantErr: "expected in after not"},
+		{src: "first is 1", wantErr: "expected null after is"},
+		{src: "first =~ /(/", wantErr: "invalid regular expression at offset 9"},
+		{src: "first =~ /a", wantErr: "unterminated regular expression"},
+		{src: "1 < 2 == true", wantErr: "offset 6"},
+
+		// Type errors
+		{src: "lower(1)", wantErr: "lower: argument 1 must be string, got number"},
+		{src: "1 + 'a'", wantErr: "offset"},
+		{src: "-'a'", wantErr: "offset"},
+		{src: "if(1, 2, 3)", wantErr: "if: condition must be bool"},
+		{src: "true =~ /a/", wantErr: "cannot match bool"},
+		{src: "1 in ['a']", wantErr: "cannot compare number and string"},
+		{src: "date_add(since, 1, 'fortnight')", wantErr: "fortnight"},
+		{src: "nope(1)", wantErr: "nope"},
+		{src: "round()", wantErr: "round"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			e, err := Compile(tt.src, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Compile error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if e.Type() != tt.typ {
+				t.Errorf("type = %s, want %s", e.Type(), tt.typ)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	e, err := Compile("concat(first, owner.name, project.id, $.batch)", []string{"project"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.Keys(), ","); got != "first,owner" {
+		t.Errorf("Keys() = %s, want first,owner", got)
+	}
+}
@@ -0,0 +1,411 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// function is a built-in function. Arguments are converted to the parameter types before call
+// is invoked; a null argument makes the result null unless nulls is set.
+type function struct {
+	params   []Type
+	optional int  // Trailing parameters that may be omitted
+	variadic bool // The last parameter repeats
+	result   Type
+	nulls    bool
+	choices  map[int]choiceSet // Allowed values of string parameters, checked when given as literals
+	call     func(args []interface{}) (interface{}, error)
+}
+
+// choiceSet is the values a string parameter such as a time unit accepts
+type choiceSet struct {
+	name   string
+	values []string
+}
+
+// Units of date_add, date_diff and date_trunc, and the parts of date_part
+var (
+	timeUnits = choiceSet{name: "unit", values: []string{"second", "minute", "hour", "day", "week", "month", "year"}}
+	timeParts = choiceSet{name: "part", values: []string{"year", "month", "day", "hour", "minute", "second", "weekday", "yearday", "week", "epoch"}}
+)
+
+// resolve normalizes a value; plurals such as days are accepted
+func (c choiceSet) resolve(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, v := range c.values {
+		if s == v || s == v+"s" {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("unknown %s %q (expected %s)", c.name, s, strings.Join(c.values, ", "))
+}
+
+// functions are the built-in functions by name; if and coalesce are parsed separately since
+// they only evaluate the arguments they need
+var functions = map[string]*function{
+	"concat": {params: []Type{Any}, variadic: true, result: String, nulls: true, call: func(args []interface{}) (interface{}, error) {
+		var b strings.Builder
+		for _, arg := range args {
+			if arg == nil {
+				continue
+			}
+			s, err := toText(arg)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(s)
+		}
+		return b.String(), nil
+	}},
+	"lower": stringFunc(strings.ToLower),
+	"upper": stringFunc(strings.ToUpper),
+	"trim":  stringFunc(strings.TrimSpace),
+	"length": {params: []Type{Any}, result: Number, call: func(args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case []interface{}:
+			return int64(len(v)), nil
+		case map[string]interface{}:
+			return int64(len(v)), nil
+		}
+		s, err := toString(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return int64(utf8.RuneCountInString(s)), nil
+	}},
+	"substr": {params: []Type{String, Number, Number}, optional: 1, result: String, call: func(args []interface{}) (interface{}, error) {
+		runes := []rune(args[0].(string))
+		start, err := toInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		start = clampIndex(start, len(runes))
+		end := len(runes)
+		if len(args) > 2 {
+			n, err := toInt(args[2])
+			if err != nil {
+				return nil, err
+			}
+			if n < 0 {
+				return nil, fmt.Errorf("negative length %d", n)
+			}
+			end = min(start+n, end)
+		}
+		return string(runes[start:end]), nil
+	}},
+	"replace": {params: []Type{String, String, String}, result: String, call: func(args []interface{}) (interface{}, error) {
+		return strings.ReplaceAll(args[0].(string), args[1].(string), args[2].(string)), nil
+	}},
+	"contains":    stringTest(strings.Contains),
+	"starts_with": stringTest(strings.HasPrefix),
+	"ends_with":   stringTest(strings.HasSuffix),
+	"to_string": {params: []Type{Any}, result: String, call: func(args []interface{}) (interface{}, error) {
+		return toText(args[0])
+	}},
+	"to_number": {params: []Type{Any}, result: Number, call: func(args []interface{}) (interface{}, error) {
+		return toNumber(args[0])
+	}},
+	"abs":   numberFunc(math.Abs, func(r *big.Rat) *big.Rat { return new(big.Rat).Abs(r) }),
+	"floor": numberFunc(math.Floor, ratFloor),
+	"ceil": numberFunc(math.Ceil, func(r *big.Rat) *big.Rat {
+		return new(big.Rat).Neg(ratFloor(new(big.Rat).Neg(r)))
+	}),
+	"round": {params: []Type{Number, Number}, optional: 1, result: Number, call: func(args []interface{}) (interface{}, error) {
+		digits := 0
+		if len(args) > 1 {
+			var err error
+			if digits, err = toInt(args[1]); err != nil {
+				return nil, err
+			}
+		}
+		if r, ok := exactOf(args[0]); ok {
+			return exact(roundRat(r, digits)), nil
+		}
+		scale := math.Pow10(digits)
+		rounded := math.Round(toFloat(args[0])*scale) / scale
+		if digits <= 0 && math.Abs(rounded) < math.MaxInt64 {
+			return int64(rounded), nil
+		}
+		return rounded, nil
+	}},
+	"now": {result: Time, call: func([]interface{}) (interface{}, error) {
+		return time.Now().UTC(), nil
+	}},
+	"to_time": {params: []Type{Any, String}, optional: 1, result: Time, call: func(args []interface{}) (interface{}, error) {
+		layout := ""
+		if len(args) > 1 {
+			layout = args[1].(string)
+		}
+		return parseTime(args[0], layout)
+	}},
+	"format_time": {params: []Type{Time, String}, result: String, call: func(args []interface{}) (interface{}, error) {
+		return args[0].(time.Time).Format(args[1].(string)), nil
+	}},
+	"date_add": {params: []Type{Time, Number, String}, result: Time, choices: map[int]choiceSet{2: timeUnits}, call: func(args []interface{}) (interface{}, error) {
+		n, err := toInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return dateAdd(args[0].(time.Time), n, args[2].(string))
+	}},
+	"date_diff": {params: []Type{Time, Time, String}, result: Number, choices: map[int]choiceSet{2: timeUnits}, call: func(args []interface{}) (interface{}, error) {
+		return dateDiff(args[0].(time.Time), args[1].(time.Time), args[2].(string))
+	}},
+	"date_trunc": {params: []Type{Time, String}, result: Time, choices: map[int]choiceSet{1: timeUnits}, call: func(args []interface{}) (interface{}, error) {
+		return dateTrunc(args[0].(time.Time), args[1].(string))
+	}},
+	"date_part": {params: []Type{Time, String}, result: Number, choices: map[int]choiceSet{1: timeParts}, call: func(args []interface{}) (interface{}, error) {
+		return datePart(args[0].(time.Time), args[1].(string))
+	}},
+}
+
+// stringFunc maps a string to a string
+func stringFunc(fn func(string) string) *function {
+	return &function{params: []Type{String}, result: String, call: func(args []interface{}) (interface{}, error) {
+		return fn(args[0].(string)), nil
+	}}
+}
+
+// stringTest tests a string against another
+func stringTest(fn func(s, sub string) bool) *function {
+	return &function{params: []Type{String, String}, result: Bool, call: func(args []interface{}) (interface{}, error) {
+		return fn(args[0].(string), args[1].(string)), nil
+	}}
+}
+
+// numberFunc maps a number: exact numbers with exactFn, floats with fn
+func numberFunc(fn func(float64) float64, exactFn func(*big.Rat) *big.Rat) *function {
+	return &function{params: []Type{Number}, result: Number, call: func(args []interface{}) (interface{}, error) {
+		if r, ok := exactOf(args[0]); ok {
+			return exact(exactFn(r)), nil
+		}
+		return fn(args[0].(float64)), nil
+	}}
+}
+
+// ratFloor rounds an exact number down to a whole number
+func ratFloor(r *big.Rat) *big.Rat {
+	// Euclidean division by the positive denominator rounds towards -Inf
+	q := new(big.Int).Div(r.Num(), r.Denom())
+	return new(big.Rat).SetInt(q)
+}
+
+// roundRat rounds an exact number to digits fractional digits (tens, hundreds... when
+// negative), halves away from zero
+func roundRat(r *big.Rat, digits int) *big.Rat {
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(digits))), nil))
+	scaled := new(big.Rat).Set(r)
+	if digits >= 0 {
+		scaled.Mul(scaled, scale)
+	} else {
+		scaled.Quo(scaled, scale)
+	}
+	// FloatString rounds halves away from zero
+	rounded, _ := new(big.Rat).SetString(scaled.FloatString(0))
+	if digits >= 0 {
+		return rounded.Quo(rounded, scale)
+	}
+	return rounded.Mul(rounded, scale)
+}
+
+func abs(i int) int {
+	return max(i, -i)
+}
+
+// convertArg converts an argument to the type of its parameter
+func convertArg(v interface{}, t Type) (interface{}, error) {
+	switch t {
+	case Number:
+		return toNumber(v)
+	case String:
+		return toString(v)
+	case Bool:
+		return toBool(v)
+	case Time:
+		return toTime(v)
+	}
+	return v, nil
+}
+
+// paramType returns the type of the i-th parameter
+func (fn *function) paramType(i int) Type {
+	if i >= len(fn.params) {
+		return fn.params[len(fn.params)-1]
+	}
+	return fn.params[i]
+}
+
+// apply converts the arguments and calls the function
+func (fn *function) apply(args []interface{}) (interface{}, error) {
+	for i, arg := range args {
+		if arg == nil {
+			continue
+		}
+		v, err := convertArg(arg, fn.paramType(i))
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		args[i] = v
+	}
+	return fn.call(args)
+}
+
+// parseTime reads a time from a string or an epoch number. layout is a Go layout, epoch_s,
+// epoch_ms, epoch_us or epoch_ns; without one, strings are RFC 3339 or YYYY-MM-DD and numbers
+// are epoch seconds.
+func parseTime(v interface{}, layout string) (time.Time, error) {
+	unit := time.Second
+	switch strings.ToLower(layout) {
+	case "":
+		if !isNumeric(v) {
+			return toTime(v)
+		}
+	case "epoch_s":
+	case "epoch_ms":
+		unit = time.Millisecond
+	case "epoch_us":
+		unit = time.Microsecond
+	case "epoch_ns":
+		unit = time.Nanosecond
+	default:
+		s, err := toString(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Parse(layout, strings.TrimSpace(s))
+	}
+
+	n, err := toNumber(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if i, ok := n.(int64); ok {
+		return time.Unix(0, 0).Add(time.Duration(i) * unit).UTC(), nil
+	}
+	return time.Unix(0, 0).Add(time.Duration(toFloat(n) * float64(unit))).UTC(), nil
+}
+
+// unitDuration is the length of the fixed units
+var unitDuration = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+// dateAdd adds n units; months and years follow the calendar, days and weeks keep the clock
+// time across daylight saving changes
+func dateAdd(t time.Time, n int, unit string) (time.Time, error) {
+	unit, err := timeUnits.resolve(unit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch unit {
+	case "month":
+		return addMonths(t, n), nil
+	case "year":
+		return addMonths(t, 12*n), nil
+	case "day":
+		return t.AddDate(0, 0, n), nil
+	case "week":
+		return t.AddDate(0, 0, 7*n), nil
+	}
+	return t.Add(time.Duration(n) * unitDuration[unit]), nil
+}
+
+// addMonths adds calendar months, clamping the day to the end of shorter months, so that
+// 2024-01-31 plus a month is 2024-02-29
+func addMonths(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(n), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(d, last)-1)
+}
+
+// dateDiff counts the whole units from b to a
+func dateDiff(a, b time.Time, unit string) (interface{}, error) {
+	unit, err := timeUnits.resolve(unit)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := unitDuration[unit]; ok {
+		return int64(a.Sub(b) / d), nil
+	}
+
+	b = b.In(a.Location())
+	months := (a.Year()-b.Year())*12 + int(a.Month()-b.Month())
+	// Only count a month once b has reached the same point in it
+	switch shifted := addMonths(b, months); {
+	case months > 0 && shifted.After(a):
+		months--
+	case months < 0 && shifted.Before(a):
+		months++
+	}
+	if unit == "year" {
+		return int64(months / 12), nil
+	}
+	return int64(months), nil
+}
+
+// dateTrunc truncates a time to the start of its unit; weeks start on Monday
+func dateTrunc(t time.Time, unit string) (time.Time, error) {
+	unit, err := timeUnits.resolve(unit)
+	if err != nil {
+		return time.Time{}, err
+	}
+	y, m, d := t.Date()
+	loc := t.Location()
+	switch unit {
+	case "year":
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc), nil
+	case "week":
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc), nil
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, loc), nil
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc), nil
+	case "minute":
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc), nil
+	default:
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc), nil
+	}
+}
+
+// datePart extracts a calendar field; weekday counts from Sunday (0) and week is the ISO week
+func datePart(t time.Time, part string) (interface{}, error) {
+	part, err := timeParts.resolve(part)
+	if err != nil {
+		return nil, err
+	}
+	switch part {
+	case "year":
+		return int64(t.Year()), nil
+	case "month":
+		return int64(t.Month()), nil
+	case "day":
+		return int64(t.Day()), nil
+	case "hour":
+		return int64(t.Hour()), nil
+	case "minute":
+		return int64(t.Minute()), nil
+	case "second":
+		return int64(t.Second()), nil
+	case "weekday":
+		return int64(t.Weekday()), nil
+	case "yearday":
+		return int64(t.YearDay()), nil
+	case "week":
+		_, week := t.ISOWeek()
+		return int64(week), nil
+	default:
+		return t.Unix(), nil
+	}
+}
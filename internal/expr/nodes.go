@@ -0,0 +1,536 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+
+	"github.com/kweheliye/json2parquet/internal/jsonpath"
+)
+
+// node is a compiled expression; typ is its static type
+type node interface {
+	typ() Type
+	eval(env *Env) (interface{}, error)
+}
+
+// locate wraps an error in an *Error naming the failing part, unless a nested part already did
+func locate(span string, err error) error {
+	var located *Error
+	if errors.As(err, &located) {
+		return err
+	}
+	return &Error{Expr: span, Err: err}
+}
+
+// literalNode is a string, number, boolean or null constant
+type literalNode struct {
+	value interface{}
+	t     Type
+}
+
+func (n literalNode) typ() Type                      { return n.t }
+func (n literalNode) eval(*Env) (interface{}, error) { return n.value, nil }
+
+// pathNode reads a value from the current object, the root or a variable
+type pathNode struct {
+	variable string // Variable the path reads from, if any
+	root     bool   // The path reads from the root record
+	path     *jsonpath.Path
+}
+
+func (n pathNode) typ() Type { return Any }
+
+func (n pathNode) eval(env *Env) (interface{}, error) {
+	data := env.Current
+	switch {
+	case n.variable != "":
+		data = env.Vars[n.variable]
+	case n.root:
+		data = env.Root
+	}
+	if data == nil {
+		return nil, nil
+	}
+	return n.path.Value(data), nil
+}
+
+// negNode is -x
+type negNode struct {
+	inner node
+	span  string
+}
+
+func (n negNode) typ() Type { return Number }
+
+func (n negNode) eval(env *Env) (interface{}, error) {
+	v, err := n.inner.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	num, err := toNumber(v)
+	if err != nil {
+		return nil, locate(n.span, err)
+	}
+	switch num := num.(type) {
+	case int64:
+		if num != math.MinInt64 {
+			return -num, nil
+		}
+		return exact(new(big.Rat).Neg(new(big.Rat).SetInt64(num))), nil
+	case *big.Rat:
+		return exact(new(big.Rat).Neg(num)), nil
+	}
+	return -num.(float64), nil
+}
+
+// arithNode is x + y, x - y, x * y, x / y or x % y. + also joins two strings. Integers that
+// overflow int64 and quotients that are not whole continue as exact *big.Rat values.
+type arithNode struct {
+	op          string
+	left, right node
+	t           Type
+	span        string
+}
+
+func (n arithNode) typ() Type { return n.t }
+
+func (n arithNode) eval(env *Env) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+
+	if n.op == "+" {
+		ls, lok := l.(string)
+		rs, rok := r.(string)
+		if lok && rok {
+			return ls + rs, nil
+		}
+	}
+
+	ln, err := toNumber(l)
+	if err != nil {
+		return nil, locate(n.span, err)
+	}
+	rn, err := toNumber(r)
+	if err != nil {
+		return nil, locate(n.span, err)
+	}
+
+	li, lInt := ln.(int64)
+	ri, rInt := rn.(int64)
+	if lInt && rInt {
+		if v, ok := intArith(n.op, li, ri); ok {
+			return v, nil
+		}
+	}
+
+	// Exact unless a float64 is involved; integers overflowing int64 and fractions end up here
+	lr, lExact := exactOf(ln)
+	rr, rExact := exactOf(rn)
+	if lExact && rExact {
+		if (n.op == "/" || n.op == "%") && rr.Sign() == 0 {
+			return nil, locate(n.span, fmt.Errorf("division by zero"))
+		}
+		return exact(ratArith(n.op, lr, rr)), nil
+	}
+
+	lf, rf := toFloat(ln), toFloat(rn)
+	switch n.op {
+	case "+":
+		return lf + rf, nil
+	case "-":
+		return lf - rf, nil
+	case "*":
+		return lf * rf, nil
+	case "/":
+		if rf == 0 {
+			return nil, locate(n.span, fmt.Errorf("division by zero"))
+		}
+		return lf / rf, nil
+	default:
+		if rf == 0 {
+			return nil, locate(n.span, fmt.Errorf("division by zero"))
+		}
+		return math.Mod(lf, rf), nil
+	}
+}
+
+// intArith applies an operator to two int64 values; ok is false when the result does not fit
+// an int64 or, for / and % by zero, is left to the exact arithmetic to report
+func intArith(op string, l, r int64) (int64, bool) {
+	switch op {
+	case "+":
+		sum := l + r
+		return sum, (l^sum)&(r^sum) >= 0
+	case "-":
+		diff := l - r
+		return diff, (l^r)&(l^diff) >= 0
+	case "*":
+		if l == 0 || r == 0 {
+			return 0, true
+		}
+		prod := l * r
+		return prod, prod/r == l && !(l == -1 && r == math.MinInt64) && !(r == -1 && l == math.MinInt64)
+	case "/":
+		if r == 0 || l%r != 0 || (l == math.MinInt64 && r == -1) {
+			return 0, false
+		}
+		return l / r, true
+	default:
+		if r == 0 {
+			return 0, false
+		}
+		return l % r, true
+	}
+}
+
+// ratArith applies an operator to two exact numbers; r is not zero for / and %
+func ratArith(op string, l, r *big.Rat) *big.Rat {
+	switch op {
+	case "+":
+		return new(big.Rat).Add(l, r)
+	case "-":
+		return new(big.Rat).Sub(l, r)
+	case "*":
+		return new(big.Rat).Mul(l, r)
+	case "/":
+		return new(big.Rat).Quo(l, r)
+	default:
+		// Truncated division like Go's %: l - r*trunc(l/r)
+		q := new(big.Rat).Quo(l, r)
+		trunc := new(big.Rat).SetInt(new(big.Int).Quo(q.Num(), q.Denom()))
+		return new(big.Rat).Sub(l, trunc.Mul(trunc, r))
+	}
+}
+
+// compareNode is x == y, x != y, x < y, x <= y, x > y or x >= y. Equality holds between
+// nulls; ordering a null holds never.
+type compareNode struct {
+	op          string
+	left, right node
+	span        string
+}
+
+func (n compareNode) typ() Type { return Bool }
+
+func (n compareNode) eval(env *Env) (interface{}, error) {
+	l, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	}
+	if l == nil || r == nil {
+		return false, nil
+	}
+	c, ok := compareValues(l, r)
+	if !ok {
+		return nil, locate(n.span, fmt.Errorf("cannot order %s and %s", describe(l), describe(r)))
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	default:
+		return c >= 0, nil
+	}
+}
+
+// equal reports whether two values are equal; null equals only null, and values that do not
+// compare are not equal
+func equal(l, r interface{}) bool {
+	if l == nil || r == nil {
+		return l == nil && r == nil
+	}
+	c, ok := compareValues(l, r)
+	return ok && c == 0
+}
+
+// inNode is x in [a, b] or x not in [a, b]
+type inNode struct {
+	inner  node
+	list   []node
+	negate bool
+	span   string
+}
+
+func (n inNode) typ() Type { return Bool }
+
+func (n inNode) eval(env *Env) (interface{}, error) {
+	v, err := n.inner.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range n.list {
+		r, err := item.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if equal(v, r) {
+			return !n.negate, nil
+		}
+	}
+	return n.negate, nil
+}
+
+// regexNode is x =~ /pattern/ or x !~ /pattern/; numbers are matched by their text and null
+// never matches
+type regexNode struct {
+	inner  node
+	re     *regexp.Regexp
+	negate bool
+	span   string
+}
+
+func (n regexNode) typ() Type { return Bool }
+
+func (n regexNode) eval(env *Env) (interface{}, error) {
+	v, err := n.inner.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return n.negate, nil
+	}
+	if !isNumeric(v) {
+		if _, ok := v.(string); !ok {
+			return nil, locate(n.span, fmt.Errorf("cannot match %s against a regular expression", describe(v)))
+		}
+	}
+	s, err := toString(v)
+	if err != nil {
+		return nil, locate(n.span, err)
+	}
+	return n.re.MatchString(s) != n.negate, nil
+}
+
+// nullNode is x is null or x is not null; a missing value is null
+type nullNode struct {
+	inner  node
+	negate bool
+}
+
+func (n nullNode) typ() Type { return Bool }
+
+func (n nullNode) eval(env *Env) (interface{}, error) {
+	v, err := n.inner.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return (v == nil) != n.negate, nil
+}
+
+// logicNode is x && y or x || y, evaluated left to right until the result is known
+type logicNode struct {
+	and         bool
+	left, right node
+	span        string
+}
+
+func (n logicNode) typ() Type { return Bool }
+
+func (n logicNode) eval(env *Env) (interface{}, error) {
+	l, err := evalBool(n.left, env, n.span)
+	if err != nil {
+		return nil, err
+	}
+	if l != n.and {
+		return l, nil
+	}
+	return evalBool(n.right, env, n.span)
+}
+
+// notNode is !x
+type notNode struct {
+	inner node
+	span  string
+}
+
+func (n notNode) typ() Type { return Bool }
+
+func (n notNode) eval(env *Env) (interface{}, error) {
+	b, err := evalBool(n.inner, env, n.span)
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+// evalBool evaluates a condition; null is false
+func evalBool(n node, env *Env, span string) (bool, error) {
+	v, err := n.eval(env)
+	if err != nil || v == nil {
+		return false, err
+	}
+	b, err := toBool(v)
+	if err != nil {
+		return false, locate(span, err)
+	}
+	return b, nil
+}
+
+// sliceNode is s[start:end] over the characters of a string or the elements of an array.
+// Negative bounds count from the end.
+type sliceNode struct {
+	inner, start, end node // start and end are nil when omitted
+	span              string
+}
+
+func (n sliceNode) typ() Type { return n.inner.typ() }
+
+func (n sliceNode) eval(env *Env) (interface{}, error) {
+	v, err := n.inner.eval(env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+
+	var length int
+	var runes []rune
+	list, isList := v.([]interface{})
+	if isList {
+		length = len(list)
+	} else {
+		s, err := toString(v)
+		if err != nil {
+			return nil, locate(n.span, err)
+		}
+		runes = []rune(s)
+		length = len(runes)
+	}
+
+	start, err := n.bound(n.start, env, 0, length)
+	if err != nil {
+		return nil, err
+	}
+	end, err := n.bound(n.end, env, length, length)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		end = start
+	}
+	if isList {
+		return list[start:end], nil
+	}
+	return string(runes[start:end]), nil
+}
+
+// bound evaluates a slice bound, clamped to [0, length]
+func (n sliceNode) bound(b node, env *Env, def, length int) (int, error) {
+	if b == nil {
+		return def, nil
+	}
+	v, err := b.eval(env)
+	if err != nil {
+		return 0, err
+	}
+	if v == nil {
+		return def, nil
+	}
+	i, err := toInt(v)
+	if err != nil {
+		return 0, locate(n.span, err)
+	}
+	return clampIndex(i, length), nil
+}
+
+// clampIndex resolves a possibly negative index into [0, length]
+func clampIndex(i, length int) int {
+	if i < 0 {
+		i += length
+	}
+	return max(0, min(i, length))
+}
+
+// callNode calls a function with its evaluated arguments
+type callNode struct {
+	fn   *function
+	args []node
+	t    Type
+	span string
+}
+
+func (n callNode) typ() Type { return n.t }
+
+func (n callNode) eval(env *Env) (interface{}, error) {
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil && !n.fn.nulls {
+			return nil, nil
+		}
+		args[i] = v
+	}
+	v, err := n.fn.apply(args)
+	if err != nil {
+		return nil, locate(n.span, err)
+	}
+	return v, nil
+}
+
+// ifNode is if(cond, then, else); only the chosen branch is evaluated
+type ifNode struct {
+	cond, then, els node
+	t               Type
+	span            string
+}
+
+func (n ifNode) typ() Type { return n.t }
+
+func (n ifNode) eval(env *Env) (interface{}, error) {
+	b, err := evalBool(n.cond, env, n.span)
+	if err != nil {
+		return nil, err
+	}
+	if b {
+		return n.then.eval(env)
+	}
+	return n.els.eval(env)
+}
+
+// coalesceNode is coalesce(a, b, ...), the first argument that is not null
+type coalesceNode struct {
+	args []node
+	t    Type
+}
+
+func (n coalesceNode) typ() Type { return n.t }
+
+func (n coalesceNode) eval(env *Env) (interface{}, error) {
+	for _, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
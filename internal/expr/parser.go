@@ -0,0 +1,815 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/internal/jsonpath"
+)
+
+// parser reads an expression, type checking each part as it is built
+type parser struct {
+	src  string
+	pos  int
+	vars map[string]bool
+	keys []string // Members of the current object read by the expression
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && strings.IndexByte(" \t\r\n", p.src[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// span returns the source read since start, for error messages
+func (p *parser) span(start int) string {
+	return strings.TrimSpace(p.src[start:p.pos])
+}
+
+// parse reads the whole expression
+func (p *parser) parse() (node, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos:], p.pos)
+	}
+	return n, nil
+}
+
+// parseOr reads a || b, or a or b
+func (p *parser) parseOr() (node, error) {
+	start := p.pos
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		opPos := p.pos
+		if !p.matchOperator("||") && !p.matchWord("or") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperands("||", opPos, Bool, left, right); err != nil {
+			return nil, err
+		}
+		left = logicNode{left: left, right: right, span: p.span(start)}
+	}
+}
+
+// parseAnd reads a && b, or a and b
+func (p *parser) parseAnd() (node, error) {
+	start := p.pos
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		opPos := p.pos
+		if !p.matchOperator("&&") && !p.matchWord("and") {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOperands("&&", opPos, Bool, left, right); err != nil {
+			return nil, err
+		}
+		left = logicNode{and: true, left: left, right: right, span: p.span(start)}
+	}
+}
+
+// parseNot reads !a or not a
+func (p *parser) parseNot() (node, error) {
+	p.skipSpaces()
+	start := p.pos
+	negate := p.peek() == '!' && !strings.HasPrefix(p.src[p.pos:], "!=")
+	if negate {
+		p.pos++
+	} else {
+		negate = p.matchWord("not")
+	}
+	if !negate {
+		return p.parseComparison()
+	}
+
+	inner, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOperands("!", start, Bool, inner); err != nil {
+		return nil, err
+	}
+	return notNode{inner: inner, span: p.span(start)}, nil
+}
+
+// comparisonOperators is ordered so that two-character operators are tried first
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseComparison reads a sum optionally compared with another, tested against a list or a
+// regular expression, or checked for null
+func (p *parser) parseComparison() (node, error) {
+	p.skipSpaces()
+	start := p.pos
+	left, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	opPos := p.pos
+	switch {
+	case p.matchWord("is"):
+		p.skipSpaces()
+		negate := p.matchWord("not")
+		p.skipSpaces()
+		if !p.matchWord("null") {
+			return nil, fmt.Errorf("expected null after is at offset %d", p.pos)
+		}
+		return nullNode{inner: left, negate: negate}, nil
+	case p.matchWord("in"):
+		return p.parseIn(left, false, start)
+	case p.matchWord("not"):
+		p.skipSpaces()
+		if !p.matchWord("in") {
+			return nil, fmt.Errorf("expected in after not at offset %d", p.pos)
+		}
+		return p.parseIn(left, true, start)
+	case p.matchOperator("=~"), p.matchOperator("!~"):
+		negate := p.src[opPos] == '!'
+		if t := left.typ(); t != Any && t != Null && t != String && t != Number {
+			return nil, fmt.Errorf("cannot match %s against a regular expression at offset %d", t, opPos)
+		}
+		re, err := p.parseRegex()
+		if err != nil {
+			return nil, err
+		}
+		return regexNode{inner: left, re: re, negate: negate, span: p.span(start)}, nil
+	}
+
+	for _, op := range comparisonOperators {
+		if !p.matchOperator(op) {
+			continue
+		}
+		right, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if !comparable(left.typ(), right.typ()) {
+			return nil, fmt.Errorf("cannot compare %s and %s at offset %d", left.typ(), right.typ(), opPos)
+		}
+		return compareNode{op: op, left: left, right: right, span: p.span(start)}, nil
+	}
+	if p.peek() == '=' {
+		return nil, fmt.Errorf("unexpected '=' at offset %d (use == to compare)", p.pos)
+	}
+	return left, nil
+}
+
+// parseIn reads the list of an in or not in test: ['a', 'b'] or ('a', 'b')
+func (p *parser) parseIn(left node, negate bool, start int) (node, error) {
+	p.skipSpaces()
+	var end byte
+	switch p.peek() {
+	case '[':
+		end = ']'
+	case '(':
+		end = ')'
+	default:
+		return nil, fmt.Errorf("expected a list after in at offset %d", p.pos)
+	}
+	p.pos++
+
+	n := inNode{inner: left, negate: negate}
+	for {
+		p.skipSpaces()
+		if p.peek() == end && len(n.list) == 0 {
+			p.pos++
+			break
+		}
+		itemPos := p.pos
+		item, err := p.parseAdditive()
+		if err != nil {
+			return nil, err
+		}
+		if !comparable(left.typ(), item.typ()) {
+			return nil, fmt.Errorf("cannot compare %s and %s at offset %d", left.typ(), item.typ(), itemPos)
+		}
+		n.list = append(n.list, item)
+
+		p.skipSpaces()
+		if p.peek() == ',' {
+			p.pos++
+			continue
+		}
+		if p.peek() != end {
+			return nil, fmt.Errorf("expected ',' or %q at offset %d", end, p.pos)
+		}
+		p.pos++
+		break
+	}
+	n.span = p.span(start)
+	return n, nil
+}
+
+// parseRegex reads the pattern of a regular expression match: /pattern/flags, or a quoted
+// string
+func (p *parser) parseRegex() (*regexp.Regexp, error) {
+	p.skipSpaces()
+	start := p.pos
+	var pattern, flags string
+	switch p.peek() {
+	case '/':
+		p.pos++
+		var b strings.Builder
+		for {
+			if p.eof() {
+				return nil, fmt.Errorf("unterminated regular expression at offset %d", start)
+			}
+			c := p.src[p.pos]
+			p.pos++
+			if c == '/' {
+				break
+			}
+			if c == '\\' && p.peek() == '/' {
+				c = '/'
+				p.pos++
+			}
+			b.WriteByte(c)
+		}
+		pattern = b.String()
+		flagStart := p.pos
+		for !p.eof() && strings.IndexByte("imsU", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		flags = p.src[flagStart:p.pos]
+	case '\'', '"':
+		var err error
+		if pattern, err = p.parseString(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("expected /pattern/ or a quoted string at offset %d", p.pos)
+	}
+
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression at offset %d: %w", start, err)
+	}
+	return re, nil
+}
+
+// parseAdditive reads a + b and a - b
+func (p *parser) parseAdditive() (node, error) {
+	p.skipSpaces()
+	start := p.pos
+	left, err := p.parseMultiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		opPos := p.pos
+		op := string(p.peek())
+		if op != "+" && op != "-" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseMultiplicative()
+		if err != nil {
+			return nil, err
+		}
+		t, err := arithType(op, opPos, left, right)
+		if err != nil {
+			return nil, err
+		}
+		left = arithNode{op: op, left: left, right: right, t: t, span: p.span(start)}
+	}
+}
+
+// parseMultiplicative reads a * b, a / b and a % b
+func (p *parser) parseMultiplicative() (node, error) {
+	p.skipSpaces()
+	start := p.pos
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		opPos := p.pos
+		op := string(p.peek())
+		if op != "*" && op != "/" && op != "%" {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		t, err := arithType(op, opPos, left, right)
+		if err != nil {
+			return nil, err
+		}
+		left = arithNode{op: op, left: left, right: right, t: t, span: p.span(start)}
+	}
+}
+
+// parseUnary reads -a
+func (p *parser) parseUnary() (node, error) {
+	p.skipSpaces()
+	start := p.pos
+	if p.peek() != '-' {
+		return p.parsePostfix()
+	}
+	p.pos++
+	inner, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOperands("-", start, Number, inner); err != nil {
+		return nil, err
+	}
+	if lit, ok := inner.(literalNode); ok && lit.value != nil {
+		switch v := lit.value.(type) {
+		case int64:
+			if v != math.MinInt64 {
+				return literalNode{value: -v, t: Number}, nil
+			}
+		case *big.Rat:
+			return literalNode{value: exact(new(big.Rat).Neg(v)), t: Number}, nil
+		case float64:
+			return literalNode{value: -v, t: Number}, nil
+		}
+	}
+	return negNode{inner: inner, span: p.span(start)}, nil
+}
+
+// parsePostfix reads an operand followed by slices: name[0:3], (a + b)[-2:]
+func (p *parser) parsePostfix() (node, error) {
+	start := p.pos
+	n, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == '[' {
+		open := p.pos
+		p.pos++
+		s := sliceNode{inner: n}
+		if s.start, err = p.parseBound(); err != nil {
+			return nil, err
+		}
+		if p.peek() != ':' {
+			return nil, fmt.Errorf("expected ':' at offset %d (indexes belong to paths, e.g. items[0])", p.pos)
+		}
+		p.pos++
+		if s.end, err = p.parseBound(); err != nil {
+			return nil, err
+		}
+		if p.peek() != ']' {
+			return nil, fmt.Errorf("expected ']' at offset %d", p.pos)
+		}
+		p.pos++
+		if t := n.typ(); t != Any && t != String && t != Null {
+			return nil, fmt.Errorf("cannot slice %s at offset %d", t, open)
+		}
+		s.span = p.span(start)
+		n = s
+	}
+	return n, nil
+}
+
+// parseBound reads an optional slice bound
+func (p *parser) parseBound() (node, error) {
+	p.skipSpaces()
+	if c := p.peek(); c == ':' || c == ']' {
+		return nil, nil
+	}
+	start := p.pos
+	n, err := p.parseAdditive()
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOperands("slice", start, Number, n); err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	return n, nil
+}
+
+// parsePrimary reads a literal, a parenthesized expression, a function call or a path
+func (p *parser) parsePrimary() (node, error) {
+	p.skipSpaces()
+	start := p.pos
+	switch c := p.peek(); {
+	case c == '(':
+		p.pos++
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+		}
+		p.pos++
+		return n, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalNode{value: s, t: String}, nil
+	case c >= '0' && c <= '9' || c == '.':
+		return p.parseNumber()
+	case c == '@' || c == '$':
+		return p.parsePath()
+	case isNameStart(c):
+	case c == 0:
+		return nil, fmt.Errorf("expected an operand at offset %d", start)
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", p.src[p.pos:], start)
+	}
+
+	for !p.eof() && isNameChar(p.src[p.pos]) {
+		p.pos++
+	}
+	name := p.src[start:p.pos]
+	p.skipSpaces()
+	if p.peek() == '(' {
+		return p.parseCall(name, start)
+	}
+	p.pos = start + len(name)
+
+	switch name {
+	case "true":
+		return literalNode{value: true, t: Bool}, nil
+	case "false":
+		return literalNode{value: false, t: Bool}, nil
+	case "null":
+		return literalNode{t: Null}, nil
+	case "and", "or", "not", "in", "is":
+		return nil, fmt.Errorf("expected an operand at offset %d, found %q", start, name)
+	}
+	p.pos = start
+	return p.parsePath()
+}
+
+// parseNumber reads an integer or a decimal number with an optional exponent
+func (p *parser) parseNumber() (node, error) {
+	start := p.pos
+	for !p.eof() {
+		c := p.src[p.pos]
+		exponentSign := (c == '+' || c == '-') && p.pos > start && strings.IndexByte("eE", p.src[p.pos-1]) >= 0
+		if !(c >= '0' && c <= '9' || strings.IndexByte(".eE", c) >= 0 || exponentSign) {
+			break
+		}
+		p.pos++
+	}
+	text := p.src[start:p.pos]
+	num, ok := readNumber(text)
+	if !ok {
+		return nil, fmt.Errorf("invalid number %q at offset %d", text, start)
+	}
+	return literalNode{value: num, t: Number}, nil
+}
+
+// parseString reads a single or double quoted string with backslash escapes
+func (p *parser) parseString() (string, error) {
+	start := p.pos
+	quote := p.src[p.pos]
+	p.pos++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && !p.eof():
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		case c == quote:
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string at offset %d", start)
+}
+
+// parsePath reads a JSONPath operand: name.sub[0], @.name, @['a b'] or $.name. Brackets
+// holding a slice end the path, so that name[0:3] slices the value.
+func (p *parser) parsePath() (node, error) {
+	start := p.pos
+	if c := p.peek(); c == '@' || c == '$' {
+		p.pos++
+	}
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch {
+		case isNameChar(c) || c == '.' || c == '*':
+			p.pos++
+		case c == '[':
+			end, ok := p.bracketEnd()
+			if !ok {
+				return nil, fmt.Errorf("expected ']' after offset %d", p.pos)
+			}
+			if isSlice(p.src[p.pos+1 : end]) {
+				return p.compilePath(start)
+			}
+			p.pos = end + 1
+		default:
+			return p.compilePath(start)
+		}
+	}
+	return p.compilePath(start)
+}
+
+// compilePath compiles the path read since start
+func (p *parser) compilePath(start int) (node, error) {
+	text := p.src[start:p.pos]
+	var n pathNode
+	expr := text
+	switch text[0] {
+	case '@':
+		expr = "$" + text[1:]
+	case '$':
+		n.root = true
+	default:
+		name := text
+		if i := strings.IndexAny(text, ".["); i >= 0 {
+			name = text[:i]
+		}
+		if p.vars[name] {
+			n.variable = name
+			expr = "$" + text[len(name):]
+		}
+	}
+
+	path, err := jsonpath.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("%v at offset %d", err, start)
+	}
+	n.path = path
+	if n.variable == "" && !n.root {
+		if key, ok := path.FirstKey(); ok {
+			p.keys = append(p.keys, key)
+		}
+	}
+	return n, nil
+}
+
+// bracketEnd finds the ']' closing the bracket at the current position, skipping quoted
+// strings and nested brackets
+func (p *parser) bracketEnd() (int, bool) {
+	depth := 0
+	var quote byte
+	for i := p.pos; i < len(p.src); i++ {
+		c := p.src[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// isSlice reports whether bracket contents are a slice such as 0:3 or -2: rather than a
+// JSONPath index, name or filter
+func isSlice(s string) bool {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.IndexByte("?'\"", s[0]) >= 0 {
+		return false
+	}
+	return strings.Contains(s, ":")
+}
+
+// parseCall reads the arguments of a function call and checks them against its signature
+func (p *parser) parseCall(name string, start int) (node, error) {
+	p.pos++ // '('
+	var args []node
+	var offsets []int
+	p.skipSpaces()
+	if p.peek() == ')' {
+		p.pos++
+	} else {
+		for {
+			p.skipSpaces()
+			offsets = append(offsets, p.pos)
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			p.skipSpaces()
+			if p.peek() == ',' {
+				p.pos++
+				continue
+			}
+			if p.peek() != ')' {
+				return nil, fmt.Errorf("expected ',' or ')' at offset %d", p.pos)
+			}
+			p.pos++
+			break
+		}
+	}
+	span := p.span(start)
+
+	switch name {
+	case "if":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("if expects 3 arguments (condition, then, else), got %d at offset %d", len(args), start)
+		}
+		if t := args[0].typ(); t != Bool && t != Any && t != Null {
+			return nil, fmt.Errorf("if: condition must be bool, got %s at offset %d", t, offsets[0])
+		}
+		t, ok := unify(args[1].typ(), args[2].typ())
+		if !ok {
+			return nil, fmt.Errorf("if branches differ in type: %s and %s at offset %d", args[1].typ(), args[2].typ(), start)
+		}
+		return ifNode{cond: args[0], then: args[1], els: args[2], t: t, span: span}, nil
+	case "coalesce":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("coalesce expects at least 1 argument at offset %d", start)
+		}
+		t := Null
+		for i, arg := range args {
+			var ok bool
+			if t, ok = unify(t, arg.typ()); !ok {
+				return nil, fmt.Errorf("coalesce: argument %d is %s, unlike the arguments before it at offset %d", i+1, arg.typ(), offsets[i])
+			}
+		}
+		return coalesceNode{args: args, t: t}, nil
+	}
+
+	fn, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at offset %d", name, start)
+	}
+	required := len(fn.params) - fn.optional
+	if fn.variadic {
+		required = 0
+	}
+	if len(args) < required || len(args) > len(fn.params) && !fn.variadic {
+		return nil, fmt.Errorf("%s expects %s, got %d at offset %d", name, arity(fn), len(args), start)
+	}
+	for i, arg := range args {
+		param := fn.paramType(i)
+		if !accepts(param, arg.typ()) {
+			return nil, fmt.Errorf("%s: argument %d must be %s, got %s at offset %d", name, i+1, param, arg.typ(), offsets[i])
+		}
+		choices, ok := fn.choices[i]
+		if lit, isLit := arg.(literalNode); ok && isLit && lit.t == String {
+			resolved, err := choices.resolve(lit.value.(string))
+			if err != nil {
+				return nil, fmt.Errorf("%s: argument %d: %v at offset %d", name, i+1, err, offsets[i])
+			}
+			args[i] = literalNode{value: resolved, t: String}
+		}
+	}
+	return callNode{fn: fn, args: args, t: fn.result, span: span}, nil
+}
+
+// arity describes the number of arguments a function takes
+func arity(fn *function) string {
+	n := len(fn.params)
+	switch {
+	case fn.variadic:
+		return "any number of arguments"
+	case fn.optional > 0:
+		return fmt.Sprintf("%d to %d arguments", n-fn.optional, n)
+	case n == 1:
+		return "1 argument"
+	}
+	return fmt.Sprintf("%d arguments", n)
+}
+
+// checkOperands checks that operands have type want, or a type only known when evaluated
+func checkOperands(op string, offset int, want Type, operands ...node) error {
+	for _, n := range operands {
+		if t := n.typ(); t != want && t != Any && t != Null {
+			return fmt.Errorf("%s expects %s operands, got %s at offset %d", op, want, t, offset)
+		}
+	}
+	return nil
+}
+
+// arithType checks the operands of an arithmetic operator and returns the result type.
+// + adds numbers or joins strings.
+func arithType(op string, offset int, left, right node) (Type, error) {
+	lt, rt := left.typ(), right.typ()
+	if op == "+" && (lt == String || rt == String) {
+		if (lt == String || lt == Any || lt == Null) && (rt == String || rt == Any || rt == Null) {
+			return String, nil
+		}
+		return 0, fmt.Errorf("cannot add %s and %s at offset %d (use concat to join values as text)", lt, rt, offset)
+	}
+	if err := checkOperands(op, offset, Number, left, right); err != nil {
+		return 0, err
+	}
+	if op == "+" && lt != Number && rt != Number {
+		return Any, nil // Numbers or strings, known when evaluated
+	}
+	return Number, nil
+}
+
+// comparable reports whether values of two types can be compared
+func comparable(l, r Type) bool {
+	switch {
+	case l == r, l == Any, r == Any, l == Null, r == Null:
+		return true
+	case l == Time && r == String, l == String && r == Time:
+		return true
+	}
+	return false
+}
+
+// accepts reports whether an argument of type arg can be passed for a parameter. Strings are
+// accepted for times, being parsed when evaluated.
+func accepts(param, arg Type) bool {
+	switch {
+	case param == Any, arg == Any, arg == Null, param == arg:
+		return true
+	case param == Time && arg == String:
+		return true
+	}
+	return false
+}
+
+// unify returns the type of a value that is either a or b
+func unify(a, b Type) (Type, bool) {
+	switch {
+	case a == b:
+		return a, true
+	case a == Null:
+		return b, true
+	case b == Null:
+		return a, true
+	case a == Any || b == Any:
+		return Any, true
+	}
+	return 0, false
+}
+
+// matchOperator consumes an operator
+func (p *parser) matchOperator(op string) bool {
+	if !strings.HasPrefix(p.src[p.pos:], op) {
+		return false
+	}
+	p.pos += len(op)
+	return true
+}
+
+// matchWord consumes a keyword when no name character follows it
+func (p *parser) matchWord(word string) bool {
+	rest := p.src[p.pos:]
+	if !strings.HasPrefix(rest, word) || (len(rest) > len(word) && isNameChar(rest[len(word)])) {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
@@ -0,0 +1,306 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeLayouts are tried in order when a string is used as a time
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// Numbers are int64 when whole and in range, *big.Rat when exact otherwise, e.g. read from
+// JSON number text or divided, and float64 when a float64 was involved. Arithmetic on exact
+// numbers stays exact, so an expression feeding a decimal column keeps every digit.
+
+// toNumber converts a value to a number. Numeric strings are accepted, since producers often
+// quote numbers.
+func toNumber(v interface{}) (interface{}, error) {
+	switch n := v.(type) {
+	case int64:
+		return n, nil
+	case int:
+		return int64(n), nil
+	case float64:
+		return n, nil
+	case *big.Rat:
+		return exact(n), nil
+	case json.Number:
+		if num, ok := readNumber(n.String()); ok {
+			return num, nil
+		}
+	case string:
+		if num, ok := readNumber(strings.TrimSpace(n)); ok {
+			return num, nil
+		}
+	}
+	return nil, fmt.Errorf("expected a number, got %s", describe(v))
+}
+
+// readNumber reads number text exactly; only text without an exact form, such as Inf, is
+// read as a float64
+func readNumber(s string) (interface{}, bool) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, false
+	}
+	if r, ok := new(big.Rat).SetString(s); ok {
+		return exact(r), true
+	}
+	return f, true
+}
+
+// exact normalizes an exact number: int64 when it is whole and fits, *big.Rat otherwise
+func exact(r *big.Rat) interface{} {
+	if r.IsInt() && r.Num().IsInt64() {
+		return r.Num().Int64()
+	}
+	return r
+}
+
+// exactOf returns a number returned by toNumber as a *big.Rat, unless it is a float64
+func exactOf(n interface{}) (*big.Rat, bool) {
+	switch n := n.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	case *big.Rat:
+		return n, true
+	}
+	return nil, false
+}
+
+// toFloat widens a number returned by toNumber
+func toFloat(n interface{}) float64 {
+	switch n := n.(type) {
+	case int64:
+		return float64(n)
+	case *big.Rat:
+		f, _ := n.Float64()
+		return f
+	}
+	return n.(float64)
+}
+
+// formatNumber writes an exact number in full when its decimal expansion is finite, and as
+// the nearest float64 otherwise, e.g. 1/3
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	// The expansion is finite when the denominator has no prime factors but 2 and 5
+	den := new(big.Int).Set(r.Denom())
+	digits := 0
+	for _, p := range []*big.Int{big.NewInt(2), big.NewInt(5)} {
+		n := 0
+		for q, m := new(big.Int), new(big.Int); ; n++ {
+			if q.QuoRem(den, p, m); m.Sign() != 0 {
+				break
+			}
+			den.Set(q)
+		}
+		digits = max(digits, n)
+	}
+	if den.IsInt64() && den.Int64() == 1 {
+		return r.FloatString(digits)
+	}
+	return strconv.FormatFloat(toFloat(r), 'f', -1, 64)
+}
+
+// toInt converts a whole number
+func toInt(v interface{}) (int, error) {
+	n, err := toNumber(v)
+	if err != nil {
+		return 0, err
+	}
+	switch n := n.(type) {
+	case int64:
+		return int(n), nil
+	case *big.Rat:
+		if n.IsInt() {
+			return 0, fmt.Errorf("%s is out of range", describe(v))
+		}
+		return 0, fmt.Errorf("expected a whole number, got %s", describe(v))
+	default:
+		f := n.(float64)
+		if f != math.Trunc(f) {
+			return 0, fmt.Errorf("expected a whole number, got %s", describe(v))
+		}
+		return int(f), nil
+	}
+}
+
+// toString converts a scalar to text; numbers keep their shortest form and times are RFC 3339
+func toString(v interface{}) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case json.Number:
+		return s.String(), nil
+	case int64:
+		return strconv.FormatInt(s, 10), nil
+	case int:
+		return strconv.Itoa(s), nil
+	case float64:
+		return strconv.FormatFloat(s, 'f', -1, 64), nil
+	case *big.Rat:
+		return formatNumber(s), nil
+	case bool:
+		return strconv.FormatBool(s), nil
+	case time.Time:
+		return s.Format(time.RFC3339Nano), nil
+	}
+	return "", fmt.Errorf("expected a string, got %s", describe(v))
+}
+
+// toText is toString for any value; objects and arrays are written as JSON
+func toText(v interface{}) (string, error) {
+	if s, err := toString(v); err == nil {
+		return s, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toBool accepts booleans and the strings true and false
+func toBool(v interface{}) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		if parsed, err := strconv.ParseBool(strings.TrimSpace(b)); err == nil {
+			return parsed, nil
+		}
+	}
+	return false, fmt.Errorf("expected a bool, got %s", describe(v))
+}
+
+// toTime accepts times and strings in one of the timeLayouts, read as UTC when they have no
+// offset
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		s := strings.TrimSpace(t)
+		for _, layout := range timeLayouts {
+			if parsed, err := time.Parse(layout, s); err == nil {
+				return parsed, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot read %s as a time (expected RFC 3339 or YYYY-MM-DD; use to_time with a layout)", describe(v))
+	}
+	return time.Time{}, fmt.Errorf("expected a time, got %s", describe(v))
+}
+
+// compareValues orders two values of the same kind: numbers, strings, times or booleans.
+// A string is compared with a time as a time. ok is false when the values do not compare.
+func compareValues(l, r interface{}) (int, bool) {
+	if isNumeric(l) && isNumeric(r) {
+		ln, lerr := toNumber(l)
+		rn, rerr := toNumber(r)
+		if lerr != nil || rerr != nil {
+			return 0, false
+		}
+		li, lInt := ln.(int64)
+		ri, rInt := rn.(int64)
+		if lInt && rInt {
+			return compareOrdered(li, ri), true
+		}
+		lr, lExact := exactOf(ln)
+		rr, rExact := exactOf(rn)
+		if lExact && rExact {
+			return lr.Cmp(rr), true
+		}
+		return compareOrdered(toFloat(ln), toFloat(rn)), true
+	}
+
+	_, lTime := l.(time.Time)
+	_, rTime := r.(time.Time)
+	if lTime || rTime {
+		lt, lerr := toTime(l)
+		rt, rerr := toTime(r)
+		if lerr != nil || rerr != nil {
+			return 0, false
+		}
+		return lt.Compare(rt), true
+	}
+
+	switch lv := l.(type) {
+	case string:
+		if rv, ok := r.(string); ok {
+			return strings.Compare(lv, rv), true
+		}
+	case bool:
+		if rv, ok := r.(bool); ok {
+			switch {
+			case lv == rv:
+				return 0, true
+			case rv:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func compareOrdered[T int64 | float64](l, r T) int {
+	switch {
+	case l < r:
+		return -1
+	case l > r:
+		return 1
+	}
+	return 0
+}
+
+// isNumeric reports whether a value is a number rather than a string holding one
+func isNumeric(v interface{}) bool {
+	switch v.(type) {
+	case int64, int, float64, *big.Rat, json.Number:
+		return true
+	}
+	return false
+}
+
+// describe names a value in error messages, e.g. string "abc" or object
+func describe(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if len(v) > 40 {
+			v = v[:40] + "..."
+		}
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("bool %t", v)
+	case int64, int, float64, json.Number:
+		return fmt.Sprintf("number %v", v)
+	case *big.Rat:
+		return "number " + formatNumber(v)
+	case time.Time:
+		return "time " + v.Format(time.RFC3339Nano)
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -8,11 +8,12 @@ import (
 
 // FetchConfig holds common configuration for all fetchers
 type FetchConfig struct {
-	ChunkSize  int64
-	Timeout    time.Duration
-	MaxRetries uint
-	UserAgent  string
-	AWSConfig  *aws.Config
+	ChunkSize      int64
+	Timeout        time.Duration
+	MaxRetries     uint
+	UserAgent      string
+	AWSConfig      *aws.Config
+	S3UsePathStyle bool // Path-style S3 addressing, needed by MinIO and most S3-compatible stores
 }
 
 // DefaultFetchConfig returns default configuration
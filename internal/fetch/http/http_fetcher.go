@@ -29,6 +29,13 @@ func NewHTTPFetcher(config *fetch.FetchConfig) *HTTPFetcher {
 }
 
 func (d *HTTPFetcher) FetchReader(fileURL string) (io.ReadCloser, error) {
+	rc, _, err := d.FetchReaderWithEncoding(fileURL)
+	return rc, err
+}
+
+// FetchReaderWithEncoding fetches the URL and also returns the response Content-Encoding,
+// so callers can decode bodies the HTTP client did not transparently decompress.
+func (d *HTTPFetcher) FetchReaderWithEncoding(fileURL string) (io.ReadCloser, string, error) {
 	var (
 		err         error
 		r           *stdhttp.Response
@@ -54,15 +61,16 @@ func (d *HTTPFetcher) FetchReader(fileURL string) (io.ReadCloser, error) {
 		if r != nil && r.Body != nil {
 			r.Body.Close()
 		}
-		return nil, fmt.Errorf("unable to fetch file from %s: %s", fileURL, errors.Unwrap(err))
+		return nil, "", fmt.Errorf("unable to fetch file from %s: %s", fileURL, errors.Unwrap(err))
 	}
 
 	if r.StatusCode != stdhttp.StatusOK {
 		errorText := fmt.Errorf("bad status fetching %s: %s", fileURL, r.Status)
 		log.Error(errorText)
+		r.Body.Close()
 
-		return nil, errorText
+		return nil, "", errorText
 	}
 
-	return r.Body, nil
+	return r.Body, r.Header.Get("Content-Encoding"), nil
 }
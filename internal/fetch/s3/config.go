@@ -0,0 +1,69 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// NewAWSConfig builds an AWS config from the S3 settings, falling back to the
+// default environment, shared config and credentials chain for anything left empty.
+func NewAWSConfig(ctx context.Context, cfg models.S3Config) (*aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(cfg.Profile))
+	}
+	if cfg.AccessKeyID != "" || cfg.SecretAccessKey != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, ""),
+		))
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Endpoint != "" {
+		awsCfg.BaseEndpoint = aws.String(cfg.Endpoint)
+	}
+	// S3-compatible stores usually don't care about the region, but the SDK requires one
+	if awsCfg.Region == "" {
+		awsCfg.Region = "us-east-1"
+	}
+
+	return &awsCfg, nil
+}
+
+// NewClient creates an S3 client from an AWS config
+func NewClient(awsCfg aws.Config, usePathStyle bool) *awss3.Client {
+	return awss3.NewFromConfig(awsCfg, func(o *awss3.Options) {
+		o.UsePathStyle = usePathStyle
+	})
+}
+
+// ParseURL splits an s3://bucket/key URL into bucket and key
+func ParseURL(s3URL string) (bucket, key string, err error) {
+	u, err := url.Parse(s3URL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid S3 URL %s: %w", s3URL, err)
+	}
+	if !strings.EqualFold(u.Scheme, "s3") || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %s: expected s3://bucket/key", s3URL)
+	}
+	return u.Host, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// IsS3URL reports whether the path uses the s3:// scheme
+func IsS3URL(path string) bool {
+	return strings.HasPrefix(strings.ToLower(path), "s3://")
+}
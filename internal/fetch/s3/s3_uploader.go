@@ -0,0 +1,117 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	awss3 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/kweheliye/json2parquet/internal/fetch"
+)
+
+// errUploadAborted is handed to the uploader when a writer is aborted
+var errUploadAborted = errors.New("upload aborted")
+
+// S3Uploader streams objects to S3-compatible storage using multipart uploads
+type S3Uploader struct {
+	config   *fetch.FetchConfig
+	client   *awss3.Client
+	uploader *manager.Uploader
+}
+
+// NewS3Uploader creates an uploader from config.AWSConfig; ChunkSize sets the multipart part size
+func NewS3Uploader(config *fetch.FetchConfig) (*S3Uploader, error) {
+	if config.AWSConfig == nil {
+		return nil, errors.New("AWS config is required for the S3 uploader")
+	}
+
+	awsCfg := config.AWSConfig.Copy()
+	if config.MaxRetries > 0 {
+		awsCfg.RetryMaxAttempts = int(config.MaxRetries)
+	}
+
+	client := NewClient(awsCfg, config.S3UsePathStyle)
+	uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+		if config.ChunkSize >= manager.MinUploadPartSize {
+			u.PartSize = config.ChunkSize
+		}
+		// incomplete multipart uploads are aborted when an upload fails
+		u.LeavePartsOnError = false
+	})
+
+	return &S3Uploader{config: config, client: client, uploader: uploader}, nil
+}
+
+// Open starts a streaming upload to s3://bucket/key. Bytes written to the returned writer are
+// sent as multipart upload parts; Close completes the upload and Abort cancels it.
+func (u *S3Uploader) Open(s3URL string) (*UploadWriter, error) {
+	bucket, key, err := ParseURL(s3URL)
+	if err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	w := &UploadWriter{url: s3URL, pw: pw, done: make(chan error, 1)}
+
+	go func() {
+		_, err := u.uploader.Upload(context.Background(), &awss3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   pr,
+		})
+		// unblock any pending Write if the upload failed on its own
+		pr.CloseWithError(err)
+		w.done <- err
+	}()
+
+	return w, nil
+}
+
+// Delete removes the object at s3://bucket/key, e.g. a completed upload of a failed run
+func (u *S3Uploader) Delete(s3URL string) error {
+	bucket, key, err := ParseURL(s3URL)
+	if err != nil {
+		return err
+	}
+	if _, err := u.client.DeleteObject(context.Background(), &awss3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", s3URL, err)
+	}
+	log.Debugf("Deleted %s", s3URL)
+	return nil
+}
+
+// UploadWriter is the write end of a streaming multipart upload
+type UploadWriter struct {
+	url  string
+	pw   *io.PipeWriter
+	done chan error
+}
+
+func (w *UploadWriter) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close flushes the remaining data and completes the upload
+func (w *UploadWriter) Close() error {
+	w.pw.Close()
+	if err := <-w.done; err != nil {
+		return fmt.Errorf("failed to upload %s: %w", w.url, err)
+	}
+	log.Debugf("Uploaded %s", w.url)
+	return nil
+}
+
+// Abort cancels the upload; uploaded parts of an incomplete multipart upload are discarded
+func (w *UploadWriter) Abort() error {
+	w.pw.CloseWithError(errUploadAborted)
+	if err := <-w.done; err != nil && !errors.Is(err, errUploadAborted) {
+		log.Debugf("Upload of %s aborted: %v", w.url, err)
+	}
+	return nil
+}
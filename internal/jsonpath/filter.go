@@ -0,0 +1,528 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Filter is a compiled predicate such as @.type == 'x' && @.price > 10
+type Filter struct {
+	expr node
+}
+
+// CompileFilter parses a filter expression without the surrounding ?( )
+func CompileFilter(expr string) (*Filter, error) {
+	return compileFilter(&parser{src: expr, filters: 1})
+}
+
+func compileFilter(p *parser) (*Filter, error) {
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", p.src, err)
+	}
+	p.skipSpaces()
+	if !p.eof() {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q at offset %d", p.src, p.src[p.pos:], p.pos)
+	}
+	return &Filter{expr: n}, nil
+}
+
+// Match evaluates the filter with @ bound to current and $ bound to root
+func (f *Filter) Match(current, root interface{}) bool {
+	return truthy(f.expr.eval(&env{current: current, root: root}))
+}
+
+// env holds the values operands read from
+type env struct {
+	current, root interface{}
+}
+
+// node is a filter expression; eval returns the matched values of an operand,
+// or a single bool for comparisons and logical operators
+type node interface {
+	eval(e *env) []interface{}
+}
+
+type orNode struct{ left, right node }
+
+func (n orNode) eval(e *env) []interface{} {
+	return []interface{}{truthy(n.left.eval(e)) || truthy(n.right.eval(e))}
+}
+
+type andNode struct{ left, right node }
+
+func (n andNode) eval(e *env) []interface{} {
+	return []interface{}{truthy(n.left.eval(e)) && truthy(n.right.eval(e))}
+}
+
+type notNode struct{ inner node }
+
+func (n notNode) eval(e *env) []interface{} {
+	return []interface{}{!truthy(n.inner.eval(e))}
+}
+
+// compareNode holds when any pair of operand values satisfies the operator
+type compareNode struct {
+	op          string
+	left, right node
+}
+
+func (n compareNode) eval(e *env) []interface{} {
+	for _, l := range n.left.eval(e) {
+		for _, r := range n.right.eval(e) {
+			if compare(n.op, l, r) {
+				return []interface{}{true}
+			}
+		}
+	}
+	return []interface{}{false}
+}
+
+// inNode holds when any operand value equals a value of the list: @.status in ['a', 'b']
+type inNode struct {
+	left   node
+	list   []node
+	negate bool
+}
+
+func (n inNode) eval(e *env) []interface{} {
+	for _, l := range n.left.eval(e) {
+		for _, item := range n.list {
+			for _, r := range item.eval(e) {
+				if compare("==", l, r) {
+					return []interface{}{!n.negate}
+				}
+			}
+		}
+	}
+	return []interface{}{n.negate}
+}
+
+// regexNode holds when any string or number value of the operand matches: @.name =~ /^a/i
+type regexNode struct {
+	left   node
+	re     *regexp.Regexp
+	negate bool
+}
+
+func (n regexNode) eval(e *env) []interface{} {
+	for _, v := range n.left.eval(e) {
+		var s string
+		switch sv := v.(type) {
+		case string:
+			s = sv
+		case json.Number:
+			s = sv.String()
+		default:
+			continue
+		}
+		if n.re.MatchString(s) {
+			return []interface{}{!n.negate}
+		}
+	}
+	return []interface{}{n.negate}
+}
+
+// nullNode holds when the operand is missing or null: @.deleted_at is null
+type nullNode struct {
+	inner  node
+	negate bool
+}
+
+func (n nullNode) eval(e *env) []interface{} {
+	for _, v := range n.inner.eval(e) {
+		if v != nil {
+			return []interface{}{n.negate}
+		}
+	}
+	return []interface{}{!n.negate}
+}
+
+// pathNode is an @ or $ operand
+type pathNode struct {
+	relative bool
+	path     *Path
+}
+
+func (n pathNode) eval(e *env) []interface{} {
+	if n.relative {
+		return n.path.Get(e.current)
+	}
+	return n.path.Get(e.root)
+}
+
+// literalNode is a string, number, boolean or null constant
+type literalNode struct{ value interface{} }
+
+func (n literalNode) eval(*env) []interface{} {
+	return []interface{}{n.value}
+}
+
+// truthy reports whether an operand matched: a path with at least one value,
+// or a condition that evaluated to true
+func truthy(values []interface{}) bool {
+	if len(values) == 1 {
+		if b, ok := values[0].(bool); ok {
+			return b
+		}
+	}
+	return len(values) > 0
+}
+
+// compare applies a comparison operator; numbers compare numerically, strings lexically,
+// other values only by equality
+func compare(op string, l, r interface{}) bool {
+	if c, ok := compareNumbers(l, r); ok {
+		switch op {
+		case "==":
+			return c == 0
+		case "!=":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		case ">=":
+			return c >= 0
+		}
+	}
+
+	if ls, ok := l.(string); ok {
+		if rs, ok := r.(string); ok {
+			switch op {
+			case "==":
+				return ls == rs
+			case "!=":
+				return ls != rs
+			case "<":
+				return ls < rs
+			case "<=":
+				return ls <= rs
+			case ">":
+				return ls > rs
+			case ">=":
+				return ls >= rs
+			}
+		}
+	}
+
+	switch op {
+	case "==":
+		return equalScalars(l, r)
+	case "!=":
+		return !equalScalars(l, r)
+	}
+	return false
+}
+
+// equalScalars compares booleans and nulls; objects and arrays never compare equal
+func equalScalars(l, r interface{}) bool {
+	switch lv := l.(type) {
+	case nil:
+		return r == nil
+	case bool:
+		rv, ok := r.(bool)
+		return ok && lv == rv
+	}
+	return false
+}
+
+// parseOr reads a || b, or a or b
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.matchOperator("||") && !p.matchWord("or") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+}
+
+// parseAnd reads a && b, or a and b
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.matchOperator("&&") && !p.matchWord("and") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+}
+
+// parseUnary reads !a, not a, (a) or a comparison
+func (p *parser) parseUnary() (node, error) {
+	p.skipSpaces()
+	negate := p.peek() == '!' && !strings.HasPrefix(p.src[p.pos:], "!=")
+	if negate {
+		p.pos++
+	} else {
+		negate = p.matchWord("not")
+	}
+
+	switch {
+	case negate:
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	case p.peek() == '(':
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+		}
+		p.pos++
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOperators is ordered so that two-character operators are tried first
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseComparison reads an operand optionally followed by a comparison, in list, regex match
+// or null check
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	switch {
+	case p.matchWord("is"):
+		p.skipSpaces()
+		negate := p.matchWord("not")
+		p.skipSpaces()
+		if !p.matchWord("null") {
+			return nil, fmt.Errorf("expected null after is at offset %d", p.pos)
+		}
+		return nullNode{inner: left, negate: negate}, nil
+	case p.matchWord("in"):
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{left: left, list: list}, nil
+	case p.matchWord("not"):
+		p.skipSpaces()
+		if !p.matchWord("in") {
+			return nil, fmt.Errorf("expected in after not at offset %d", p.pos)
+		}
+		list, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return inNode{left: left, list: list, negate: true}, nil
+	case p.matchOperator("=~"), p.matchOperator("!~"):
+		negate := p.src[p.pos-2] == '!'
+		re, err := p.parseRegex()
+		if err != nil {
+			return nil, err
+		}
+		return regexNode{left: left, re: re, negate: negate}, nil
+	}
+
+	for _, op := range comparisonOperators {
+		if p.matchOperator(op) {
+			right, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+// parseList reads the operands of an in list: ['a', 'b'] or ('a', 'b')
+func (p *parser) parseList() ([]node, error) {
+	p.skipSpaces()
+	var end byte
+	switch p.peek() {
+	case '[':
+		end = ']'
+	case '(':
+		end = ')'
+	default:
+		return nil, fmt.Errorf("expected a list after in at offset %d", p.pos)
+	}
+	p.pos++
+
+	var list []node
+	for {
+		p.skipSpaces()
+		if p.peek() == end && len(list) == 0 {
+			p.pos++
+			return list, nil
+		}
+		item, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+
+		p.skipSpaces()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case end:
+			p.pos++
+			return list, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or %q at offset %d", end, p.pos)
+		}
+	}
+}
+
+// parseRegex reads the pattern of a regex match: /pattern/flags, or a quoted string
+func (p *parser) parseRegex() (*regexp.Regexp, error) {
+	p.skipSpaces()
+	start := p.pos
+	var pattern, flags string
+	switch p.peek() {
+	case '/':
+		p.pos++
+		var b strings.Builder
+		for {
+			if p.eof() {
+				return nil, fmt.Errorf("unterminated regular expression at offset %d", start)
+			}
+			c := p.src[p.pos]
+			p.pos++
+			if c == '/' {
+				break
+			}
+			if c == '\\' && p.peek() == '/' {
+				c = '/'
+				p.pos++
+			}
+			b.WriteByte(c)
+		}
+		pattern = b.String()
+		flagStart := p.pos
+		for !p.eof() && strings.IndexByte("imsU", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		flags = p.src[flagStart:p.pos]
+	case '\'', '"':
+		var err error
+		if pattern, err = p.parseString(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("expected /pattern/ or a quoted string at offset %d", p.pos)
+	}
+
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression at offset %d: %w", start, err)
+	}
+	return re, nil
+}
+
+// operandStop ends the names and words of filter operands
+const operandStop = " \t=!<>&|()[],~"
+
+// parseOperand reads @path, $path, a quoted string, a number, true, false or null
+func (p *parser) parseOperand() (node, error) {
+	p.skipSpaces()
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		start := p.pos
+		segments, spans, err := p.parsePath(c)
+		if err != nil {
+			return nil, err
+		}
+		path := &Path{expr: p.src[start:p.pos], segments: segments, spans: spans}
+		return pathNode{relative: c == '@', path: path}, nil
+	case c == '\'' || c == '"':
+		s, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalNode{value: s}, nil
+	}
+
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(operandStop, rune(p.src[p.pos])) {
+		p.pos++
+	}
+	word := p.src[start:p.pos]
+	switch word {
+	case "true":
+		return literalNode{value: true}, nil
+	case "false":
+		return literalNode{value: false}, nil
+	case "null":
+		return literalNode{value: nil}, nil
+	case "":
+		return nil, fmt.Errorf("expected an operand at offset %d", start)
+	}
+	f, err := strconv.ParseFloat(word, 64)
+	if err != nil {
+		return nil, fmt.Errorf("unexpected %q at offset %d", word, start)
+	}
+	// Keep the literal's text so it compares exactly with the numbers of the document
+	if _, exact := new(big.Rat).SetString(word); exact {
+		return literalNode{value: json.Number(word)}, nil
+	}
+	return literalNode{value: f}, nil
+}
+
+// matchOperator consumes an operator
+func (p *parser) matchOperator(op string) bool {
+	if !strings.HasPrefix(p.src[p.pos:], op) {
+		return false
+	}
+	p.pos += len(op)
+	return true
+}
+
+// matchWord consumes a keyword such as and, or, not or in when no name character follows it
+func (p *parser) matchWord(word string) bool {
+	rest := p.src[p.pos:]
+	if !strings.HasPrefix(rest, word) || (len(rest) > len(word) && isNameChar(rest[len(word)])) {
+		return false
+	}
+	p.pos += len(word)
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
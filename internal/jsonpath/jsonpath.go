@@ -0,0 +1,737 @@
+// Package jsonpath compiles and evaluates JSONPath expressions against decoded JSON
+// (map[string]interface{}, []interface{}, json.Number, string, bool and nil values).
+//
+// Supported syntax:
+//
+//	$                    the root (optional: "a.b" is the same as "$.a.b")
+//	.key  ['key']        member access; bracket form for keys with dots or spaces
+//	[0]  [-1]  [0,2]     array indexes, negative from the end
+//	[1:3]  [::2]         array slices
+//	.*  [*]              all members or elements
+//	..key  ..*  ..[0]    recursive descent
+//	[?(@.type=='x')]     filters: comparisons, &&, ||, !, parentheses and existence checks
+package jsonpath
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Path is a compiled JSONPath expression, safe for concurrent use
+type Path struct {
+	expr     string
+	segments []segment
+	spans    []string // source text of each segment
+}
+
+// Trail records an array element entered on the way to a match, together with the
+// member name that held the array and the element's position in it, e.g.
+// {"projects", <project>, 0, 1} for the first project of $.projects[*].tasks.
+// Depth is the number of path segments that selected the element, see Prefix.
+type Trail struct {
+	Name  string
+	Value interface{}
+	Index int
+	Depth int
+}
+
+// match is a value reached while evaluating a path
+type match struct {
+	value interface{}
+	key   string // member name the value, or its enclosing array, was read from
+	depth int    // index of the segment being applied
+	trail []Trail
+}
+
+// segment is one step of a path
+type segment interface {
+	apply(m match, root interface{}, flatten bool, out []match) []match
+	definite() bool
+}
+
+// Compile parses a JSONPath expression
+func Compile(expr string) (*Path, error) {
+	p := &parser{src: normalize(expr)}
+	segments, spans, err := p.parsePath('$')
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %w", expr, err)
+	}
+	if !p.eof() {
+		return nil, fmt.Errorf("invalid JSONPath %q: unexpected %q at offset %d", expr, p.src[p.pos:], p.pos)
+	}
+	return &Path{expr: expr, segments: segments, spans: spans}, nil
+}
+
+// MustCompile is like Compile but panics on invalid expressions
+func MustCompile(expr string) *Path {
+	p, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// normalize turns the dotted shorthand ("a.b", "[0].a", "") into a rooted expression
+func normalize(expr string) string {
+	expr = strings.TrimSpace(expr)
+	switch {
+	case expr == "":
+		return "$"
+	case strings.HasPrefix(expr, "$"):
+		return expr
+	case strings.HasPrefix(expr, "["), strings.HasPrefix(expr, ".."):
+		return "$" + expr
+	default:
+		return "$." + expr
+	}
+}
+
+// String returns the expression the path was compiled from
+func (p *Path) String() string {
+	return p.expr
+}
+
+// IsRoot reports whether the path selects the document root itself
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+// Definite reports whether the path can match at most one value, i.e. it only
+// uses member names and single indexes
+func (p *Path) Definite() bool {
+	for _, s := range p.segments {
+		if !s.definite() {
+			return false
+		}
+	}
+	return true
+}
+
+// Len returns the number of segments in the path
+func (p *Path) Len() int {
+	return len(p.segments)
+}
+
+// Key returns the rooted expression of the first n segments without those selecting array
+// elements (wildcards, indexes, slices and filters), so that paths reaching the same objects
+// through different selectors share a key, e.g. "$.projects.tasks" for Key(3) of "projects[?(@.active)].tasks[0]"
+func (p *Path) Key(n int) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for i, s := range p.segments[:n] {
+		switch s.(type) {
+		case wildcardSegment, indexSegment, sliceSegment, filterSegment:
+			continue
+		}
+		b.WriteString(p.spans[i])
+	}
+	return b.String()
+}
+
+// FirstKey returns the member name of the first segment, if the path starts with one
+func (p *Path) FirstKey() (string, bool) {
+	if len(p.segments) == 0 {
+		return "", false
+	}
+	if m, ok := p.segments[0].(memberSegment); ok && len(m.names) == 1 {
+		return m.names[0], true
+	}
+	return "", false
+}
+
+// CaseInsensitive returns a copy of the path whose member names also match keys differing
+// only in case, e.g. userId for "$.userid". A key matching exactly is still preferred.
+// Names inside filters are matched as written.
+func (p *Path) CaseInsensitive() *Path {
+	folded := *p
+	folded.segments = make([]segment, len(p.segments))
+	for i, s := range p.segments {
+		folded.segments[i] = foldSegment(s)
+	}
+	return &folded
+}
+
+// foldSegment makes the member names of a segment match ignoring case
+func foldSegment(s segment) segment {
+	switch s := s.(type) {
+	case memberSegment:
+		s.fold = true
+		return s
+	case descendantSegment:
+		return descendantSegment{inner: foldSegment(s.inner)}
+	}
+	return s
+}
+
+// Get returns all values matched in data, in document order
+func (p *Path) Get(data interface{}) []interface{} {
+	matches := p.eval(data, false)
+	values := make([]interface{}, len(matches))
+	for i, m := range matches {
+		values[i] = m.value
+	}
+	return values
+}
+
+// Value returns the single value of a definite path, or all matches of an indefinite path
+// as a slice. It returns nil when nothing matches.
+func (p *Path) Value(data interface{}) interface{} {
+	values := p.Get(data)
+	if p.Definite() {
+		if len(values) == 0 {
+			return nil
+		}
+		return values[0]
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	return values
+}
+
+// Walk calls fn for every match in data together with the array elements entered to reach it.
+// Unlike Get, a member name applied to an array is applied to each of its elements, so
+// "projects.tasks" reaches the tasks of every project.
+func (p *Path) Walk(data interface{}, fn func(value interface{}, trail []Trail) error) error {
+	for _, m := range p.eval(data, true) {
+		if err := fn(m.value, m.trail); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Path) eval(data interface{}, flatten bool) []match {
+	current := []match{{value: data}}
+	for i, s := range p.segments {
+		var next []match
+		for _, m := range current {
+			m.depth = i
+			next = s.apply(m, data, flatten, next)
+		}
+		current = next
+		if len(current) == 0 {
+			break
+		}
+	}
+	return current
+}
+
+// element returns the match for an array element, recording it in the trail. selected is
+// false when the element is only passed through, as by a member name applied to an array.
+func element(m match, value interface{}, index int, selected bool) match {
+	depth := m.depth
+	if selected {
+		depth++
+	}
+	trail := make([]Trail, len(m.trail), len(m.trail)+1)
+	copy(trail, m.trail)
+	return match{value: value, key: m.key, depth: m.depth, trail: append(trail, Trail{Name: m.key, Value: value, Index: index, Depth: depth})}
+}
+
+// memberSegment selects one or more member names: .key, ['key'] or ['a','b']
+type memberSegment struct {
+	names []string
+	fold  bool // Match names ignoring case when no key matches exactly
+}
+
+func (s memberSegment) definite() bool { return len(s.names) == 1 }
+
+func (s memberSegment) apply(m match, root interface{}, flatten bool, out []match) []match {
+	switch v := m.value.(type) {
+	case map[string]interface{}:
+		for _, name := range s.names {
+			key, ok := name, false
+			if _, ok = v[name]; !ok && s.fold {
+				key, ok = foldKey(v, name)
+			}
+			if ok {
+				out = append(out, match{value: v[key], key: key, depth: m.depth, trail: m.trail})
+			}
+		}
+	case []interface{}:
+		if flatten {
+			for i, item := range v {
+				out = s.apply(element(m, item, i, false), root, flatten, out)
+			}
+		}
+	}
+	return out
+}
+
+// foldKey finds the key of an object equal to name ignoring case. When several keys match,
+// the first in sorted order wins so the result does not depend on map order.
+func foldKey(v map[string]interface{}, name string) (string, bool) {
+	found, ok := "", false
+	for key := range v {
+		if strings.EqualFold(key, name) && (!ok || key < found) {
+			found, ok = key, true
+		}
+	}
+	return found, ok
+}
+
+// wildcardSegment selects all members of an object or elements of an array
+type wildcardSegment struct{}
+
+func (wildcardSegment) definite() bool { return false }
+
+func (wildcardSegment) apply(m match, root interface{}, flatten bool, out []match) []match {
+	switch v := m.value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			out = append(out, match{value: v[key], key: key, depth: m.depth, trail: m.trail})
+		}
+	case []interface{}:
+		for i, item := range v {
+			out = append(out, element(m, item, i, true))
+		}
+	}
+	return out
+}
+
+// indexSegment selects array elements by position: [0], [-1] or [0,2]
+type indexSegment struct {
+	indexes []int
+}
+
+func (s indexSegment) definite() bool { return len(s.indexes) == 1 }
+
+func (s indexSegment) apply(m match, root interface{}, flatten bool, out []match) []match {
+	arr, ok := m.value.([]interface{})
+	if !ok {
+		return out
+	}
+	for _, i := range s.indexes {
+		if i < 0 {
+			i += len(arr)
+		}
+		if i >= 0 && i < len(arr) {
+			out = append(out, element(m, arr[i], i, true))
+		}
+	}
+	return out
+}
+
+// sliceSegment selects a range of array elements: [start:end:step]
+type sliceSegment struct {
+	start, end, step *int
+}
+
+func (sliceSegment) definite() bool { return false }
+
+func (s sliceSegment) apply(m match, root interface{}, flatten bool, out []match) []match {
+	arr, ok := m.value.([]interface{})
+	if !ok {
+		return out
+	}
+
+	n := len(arr)
+	step := 1
+	if s.step != nil {
+		step = *s.step
+	}
+	if step == 0 {
+		return out
+	}
+
+	bound := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += n
+		}
+		if i < 0 {
+			i = -1
+			if step > 0 {
+				i = 0
+			}
+		}
+		if i > n {
+			i = n
+		}
+		return i
+	}
+
+	if step > 0 {
+		for i := bound(s.start, 0); i < bound(s.end, n); i += step {
+			out = append(out, element(m, arr[i], i, true))
+		}
+	} else {
+		start := bound(s.start, n-1)
+		if start >= n {
+			start = n - 1
+		}
+		for i := start; i > bound(s.end, -1); i += step {
+			out = append(out, element(m, arr[i], i, true))
+		}
+	}
+	return out
+}
+
+// filterSegment keeps the array elements matching a predicate: [?(@.price > 10)]
+type filterSegment struct {
+	filter *Filter
+}
+
+func (filterSegment) definite() bool { return false }
+
+func (s filterSegment) apply(m match, root interface{}, flatten bool, out []match) []match {
+	switch v := m.value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			if s.filter.Match(item, root) {
+				out = append(out, element(m, item, i, true))
+			}
+		}
+	case map[string]interface{}:
+		if s.filter.Match(v, root) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// descendantSegment applies its inner segment to a value and all of its descendants: ..key
+type descendantSegment struct {
+	inner segment
+}
+
+func (descendantSegment) definite() bool { return false }
+
+func (s descendantSegment) apply(m match, root interface{}, flatten bool, out []match) []match {
+	out = s.inner.apply(m, root, false, out)
+	switch v := m.value.(type) {
+	case map[string]interface{}:
+		for _, key := range sortedKeys(v) {
+			out = s.apply(match{value: v[key], key: key, depth: m.depth, trail: m.trail}, root, flatten, out)
+		}
+	case []interface{}:
+		for i, item := range v {
+			out = s.apply(element(m, item, i, true), root, flatten, out)
+		}
+	}
+	return out
+}
+
+// sortedKeys returns the keys of an object in a stable order, decoded objects are unordered
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parser reads a path expression; filters reuse it for @ and $ operands
+type parser struct {
+	src     string
+	pos     int
+	filters int // nesting depth of filter expressions, where names also end at spaces and operators
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// parsePath reads the root marker (root is '$' or '@') and the segments that follow,
+// returning them with their source text. It stops at the first character that cannot
+// continue a path, which lets filters embed paths.
+func (p *parser) parsePath(root byte) ([]segment, []string, error) {
+	if p.peek() != root {
+		return nil, nil, fmt.Errorf("expected %q at offset %d", root, p.pos)
+	}
+	p.pos++
+	return p.parseSegments()
+}
+
+// parseSegments reads the segments of a path up to the first character that cannot continue it
+func (p *parser) parseSegments() ([]segment, []string, error) {
+	var segments []segment
+	var spans []string
+	for !p.eof() {
+		start := p.pos
+		switch {
+		case strings.HasPrefix(p.src[p.pos:], ".."):
+			p.pos += 2
+			var inner segment
+			var err error
+			if p.peek() == '[' {
+				inner, err = p.parseBracket()
+			} else {
+				inner, err = p.parseDotted()
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			segments = append(segments, descendantSegment{inner: inner})
+		case p.peek() == '.':
+			p.pos++
+			s, err := p.parseDotted()
+			if err != nil {
+				return nil, nil, err
+			}
+			segments = append(segments, s)
+		case p.peek() == '[':
+			s, err := p.parseBracket()
+			if err != nil {
+				return nil, nil, err
+			}
+			segments = append(segments, s)
+		default:
+			return segments, spans, nil
+		}
+		spans = append(spans, p.src[start:p.pos])
+	}
+	return segments, spans, nil
+}
+
+// parseDotted reads the name or * after a dot
+func (p *parser) parseDotted() (segment, error) {
+	if p.peek() == '*' {
+		p.pos++
+		return wildcardSegment{}, nil
+	}
+
+	stop := ".["
+	if p.filters > 0 {
+		stop = "." + operandStop
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(stop, rune(p.src[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, fmt.Errorf("expected a member name at offset %d", start)
+	}
+	return memberSegment{names: []string{p.src[start:p.pos]}}, nil
+}
+
+// parseBracket reads a [...] segment
+func (p *parser) parseBracket() (segment, error) {
+	p.pos++ // '['
+	p.skipSpaces()
+
+	var s segment
+	var err error
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		s = wildcardSegment{}
+	case c == '?':
+		s, err = p.parseFilterSegment()
+	case c == '\'' || c == '"':
+		s, err = p.parseNames()
+	default:
+		s, err = p.parseIndexes()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpaces()
+	if p.peek() != ']' {
+		return nil, fmt.Errorf("expected ']' at offset %d", p.pos)
+	}
+	p.pos++
+	return s, nil
+}
+
+// parseNames reads quoted member names: 'a' or 'a','b'
+func (p *parser) parseNames() (segment, error) {
+	var names []string
+	for {
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+
+		p.skipSpaces()
+		if p.peek() != ',' {
+			return memberSegment{names: names}, nil
+		}
+		p.pos++
+		p.skipSpaces()
+	}
+}
+
+// parseString reads a single or double quoted string with backslash escapes
+func (p *parser) parseString() (string, error) {
+	quote := p.peek()
+	if quote != '\'' && quote != '"' {
+		return "", fmt.Errorf("expected a quoted string at offset %d", p.pos)
+	}
+	p.pos++
+
+	var b strings.Builder
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch {
+		case c == '\\' && !p.eof():
+			b.WriteByte(p.src[p.pos])
+			p.pos++
+		case c == quote:
+			return b.String(), nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", fmt.Errorf("unterminated string")
+}
+
+// parseIndexes reads [0], [0,2] or a slice [start:end:step]
+func (p *parser) parseIndexes() (segment, error) {
+	end := strings.IndexByte(p.src[p.pos:], ']')
+	if end < 0 {
+		return nil, fmt.Errorf("expected ']' after offset %d", p.pos)
+	}
+	body := strings.TrimSpace(p.src[p.pos : p.pos+end])
+
+	if strings.Contains(body, ":") {
+		parts := strings.Split(body, ":")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid slice [%s]", body)
+		}
+		var bounds [3]*int
+		for i, part := range parts {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return nil, fmt.Errorf("invalid slice [%s]", body)
+			}
+			bounds[i] = &n
+		}
+		p.pos += end
+		return sliceSegment{start: bounds[0], end: bounds[1], step: bounds[2]}, nil
+	}
+
+	var indexes []int
+	for _, part := range strings.Split(body, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("invalid array index [%s]", body)
+		}
+		indexes = append(indexes, n)
+	}
+	p.pos += end
+	return indexSegment{indexes: indexes}, nil
+}
+
+// parseFilterSegment reads ?(expression)
+func (p *parser) parseFilterSegment() (segment, error) {
+	p.pos++ // '?'
+	p.skipSpaces()
+	if p.peek() != '(' {
+		return nil, fmt.Errorf("expected '(' after '?' at offset %d", p.pos)
+	}
+	p.pos++
+
+	p.filters++
+	expr, err := p.parseOr()
+	p.filters--
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.peek() != ')' {
+		return nil, fmt.Errorf("expected ')' at offset %d", p.pos)
+	}
+	p.pos++
+	return filterSegment{filter: &Filter{expr: expr}}, nil
+}
+
+// compareNumbers orders two numbers exactly: as int64 when both are integers that fit, as
+// big.Rat otherwise, so 9007199254740993 and 9007199254740992 stay apart. ok is false unless
+// both values are numbers.
+func compareNumbers(l, r interface{}) (c int, ok bool) {
+	li, lok := toInt64(l)
+	ri, rok := toInt64(r)
+	if lok && rok {
+		return cmp.Compare(li, ri), true
+	}
+	lr, lok := toRat(l)
+	rr, rok := toRat(r)
+	if lok && rok {
+		return lr.Cmp(rr), true
+	}
+	// Infinities have no exact form
+	lf, lok := toFloat(l)
+	rf, rok := toFloat(r)
+	if lok && rok {
+		return cmp.Compare(lf, rf), true
+	}
+	return 0, false
+}
+
+// toInt64 converts integer JSON numbers that fit an int64
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return i, err == nil
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	}
+	return 0, false
+}
+
+// toRat converts JSON numbers exactly
+func toRat(v interface{}) (*big.Rat, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		return new(big.Rat).SetString(n.String())
+	case float64:
+		if math.IsInf(n, 0) || math.IsNaN(n) {
+			return nil, false
+		}
+		return new(big.Rat).SetFloat64(n), true
+	case int64:
+		return new(big.Rat).SetInt64(n), true
+	case int:
+		return new(big.Rat).SetInt64(int64(n)), true
+	}
+	return nil, false
+}
+
+// toFloat converts JSON numbers for comparisons
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	case int64:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,213 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testDoc is decoded with UseNumber, like the records of the parser
+const testDoc = `{
+	"store": {
+		"name": "corner",
+		"first name": "Ada",
+		"a.b": 1,
+		"items": [
+			{"sku": "X-1", "type": "book", "price": 8, "tags": ["a"], "deleted_at": null},
+			{"sku": "x-2", "type": "book", "price": 12.5, "tags": ["b", "c"]},
+			{"sku": "Y-3", "type": "pen", "price": 2, "id": 9007199254740993},
+			{"sku": "Y-4", "type": "pen", "price": 2, "id": 9007199254740992}
+		]
+	},
+	"userId": "u1",
+	"USERID": "u2"
+}`
+
+func decode(t *testing.T, doc string) interface{} {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// render writes matches as JSON for comparison
+func render(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestGet(t *testing.T) {
+	doc := decode(t, testDoc)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		// Members and brackets
+		{"store.name", `["corner"]`},
+		{"$.store.name", `["corner"]`},
+		{"store['first name']", `["Ada"]`},
+		{`store["a.b"]`, `[1]`},
+		{"store.missing", `[]`},
+
+		// Indexes, slices and wildcards
+		{"store.items[0].sku", `["X-1"]`},
+		{"store.items[-1].sku", `["Y-4"]`},
+		{"store.items[0,2].sku", `["X-1","Y-3"]`},
+		{"store.items[1:3].sku", `["x-2","Y-3"]`},
+		{"store.items[::2].sku", `["X-1","Y-3"]`},
+		{"store.items[*].tags[0]", `["a","b"]`},
+		{"store.items[9]", `[]`},
+		{"$..tags[1]", `["c"]`},
+
+		// Filters: comparisons, precedence and keywords
+		{"store.items[?(@.type == 'book')].sku", `["X-1","x-2"]`},
+		{"store.items[?(@.price > 10)].sku", `["x-2"]`},
+		{"store.items[?(@.price >= 8 && @.type == 'book' || @.sku == 'Y-4')].sku", `["X-1","x-2","Y-4"]`},
+		{"store.items[?(@.type == 'pen' || @.price > 10 && @.type == 'book')].sku", `["x-2","Y-3","Y-4"]`},
+		{"store.items[?(!(@.type == 'pen'))].sku", `["X-1","x-2"]`},
+		{"store.items[?(not @.type == 'pen' and @.price < 10)].sku", `["X-1"]`},
+		{"store.items[?(@.id)].sku", `["Y-3","Y-4"]`},
+		{"store.items[?(@.sku in ['X-1', 'Y-3'])].sku", `["X-1","Y-3"]`},
+		{"store.items[?(@.type not in ('book'))].sku", `["Y-3","Y-4"]`},
+		{"store.items[?(@.sku =~ /^x-/i)].sku", `["X-1","x-2"]`},
+		{"store.items[?(@.sku !~ /^x-/i)].sku", `["Y-3","Y-4"]`},
+		{"store.items[?(@.deleted_at is null && @.type == 'book')].sku", `["X-1","x-2"]`},
+		{"store.items[?(@.id is not null)].sku", `["Y-3","Y-4"]`},
+		{"store.items[?(@.tags[1] == 'c')].sku", `["x-2"]`},
+		{"store.items[?(@.price == $.store.items[0].price)].sku", `["X-1"]`},
+
+		// Numbers compare exactly, not through float64
+		{"store.items[?(@.id == 9007199254740993)].sku", `["Y-3"]`},
+		{"store.items[?(@.id > 9007199254740992)].sku", `["Y-3"]`},
+		{"store.items[?(@.price == 12.50)].sku", `["x-2"]`},
+		{"store.items[?(@.price < 12.4999999999999999)].sku", `["X-1","Y-3","Y-4"]`},
+		{"store.items[?(@.price == 2e0)].sku", `["Y-3","Y-4"]`},
+		{"store.items[?(@.sku == 8)].sku", `[]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			got := p.Get(doc)
+			if got == nil {
+				got = []interface{}{}
+			}
+			if s := render(t, got); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestValue(t *testing.T) {
+	doc := decode(t, testDoc)
+	tests := []struct {
+		expr     string
+		definite bool
+		want     string
+	}{
+		{"store.name", true, `"corner"`},
+		{"store.items[1].price", true, `12.5`},
+		{"store.missing", true, `null`},
+		{"store.items[*].sku", false, `["X-1","x-2","Y-3","Y-4"]`},
+		{"store.items[?(@.type == 'none')]", false, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if p.Definite() != tt.definite {
+				t.Errorf("Definite() = %t, want %t", p.Definite(), tt.definite)
+			}
+			if s := render(t, p.Value(doc)); s != tt.want {
+				t.Errorf("Value() = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string // Substring of the error
+	}{
+		{"store.items[", "offset"},
+		{"store.items[?(@.price > )]", "offset"},
+		{"store.items[?(@.price > 1]", "')'"},
+		{"store['name", "unterminated string"},
+		{"store.items[?(@.sku =~ /(/)]", "offset"},
+		{"store.items[?(@.type in 'book')]", "offset"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := Compile(tt.expr)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Compile error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"projects", "$.projects"},
+		{"projects[*]", "$.projects"},
+		{"projects[0].tasks", "$.projects.tasks"},
+		{"projects[?(@.status == 'active')].tasks[1:]", "$.projects.tasks"},
+		{"$", "$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if got := p.Key(p.Len()); got != tt.want {
+				t.Errorf("Key() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	doc := decode(t, testDoc)
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"STORE.Name", `"corner"`},
+		{"userid", `"u2"`}, // Several keys match: the first in sorted order wins
+		{"userId", `"u1"`}, // An exact match is preferred
+		{"store.ITEMS[0].SKU", `"X-1"`},
+		{"$..SKU", `["X-1","x-2","Y-3","Y-4"]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			p, err := Compile(tt.expr)
+			if err != nil {
+				t.Fatalf("Compile: %v", err)
+			}
+			if s := render(t, p.CaseInsensitive().Value(doc)); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+			if p.Value(doc) != nil && tt.expr != "userId" {
+				t.Errorf("%s matched without case folding", tt.expr)
+			}
+		})
+	}
+}
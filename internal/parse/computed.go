@@ -0,0 +1,80 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/kweheliye/json2parquet/internal/expr"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// compileExprs compiles the expr of every computed column, by table and column name. Like
+// where predicates, leading names that are an ancestor table's name or alias read from that
+// table's row in the parent context.
+func compileExprs(config *models.ParseConfig, tree *tableTree) (map[string]map[string]*expr.Expr, error) {
+	exprs := make(map[string]map[string]*expr.Expr)
+	for _, tableConfig := range config.Tables {
+		vars := contextNames(tableConfig, tree)
+		for _, field := range getAllFields(tableConfig) {
+			if field.Expr == "" {
+				continue
+			}
+			e, err := expr.Compile(field.Expr, vars)
+			if err != nil {
+				return nil, fmt.Errorf("table %s: field %s: %w", tableConfig.Name, field.Name, err)
+			}
+			if !exprFitsColumn(e.Type(), field) {
+				return nil, fmt.Errorf("table %s: field %s: expr yields %s, which cannot be written to a %s column", tableConfig.Name, field.Name, e.Type(), field.Type)
+			}
+			if exprs[tableConfig.Name] == nil {
+				exprs[tableConfig.Name] = make(map[string]*expr.Expr)
+			}
+			exprs[tableConfig.Name][field.Name] = e
+		}
+	}
+	return exprs, nil
+}
+
+// exprFitsColumn reports whether values of an expression's static type convert to the column
+// type. Values read from the JSON (expr.Any) are converted like json_path values.
+func exprFitsColumn(t expr.Type, field models.FieldConfig) bool {
+	if t == expr.Any || t == expr.Null {
+		return true
+	}
+	switch {
+	case nestedKind(field.Type) != "":
+		return false
+	case field.Type == "string" || field.Type == "json":
+		return true
+	case isTemporal(field):
+		return t == expr.Time || t == expr.String || t == expr.Number
+	case field.Type == "bool":
+		return t == expr.Bool || t == expr.String
+	}
+	// Numeric columns
+	return t == expr.Number || t == expr.String
+}
+
+// evalExpr computes the value of a computed column from data, the object the row (or the
+// parent_refs entry) reads
+func (gp *GenericParser) evalExpr(tableConfig models.TableConfig, field models.FieldConfig, data map[string]interface{}, parentContext map[string]interface{}) (interface{}, error) {
+	value, err := gp.exprs[tableConfig.Name][field.Name].Eval(expr.Env{Current: data, Root: gp.record, Vars: parentContext})
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", field.Name, err)
+	}
+	switch v := value.(type) {
+	case time.Time:
+		// Times are written as RFC 3339 text to columns that are not temporal
+		if !isTemporal(field) {
+			return v.Format(time.RFC3339Nano), nil
+		}
+	case *big.Rat:
+		// Decimal columns round exact results themselves, others read them as JSON number text
+		if baseType(field.Type) != "decimal" {
+			return json.Number(expr.FormatNumber(v)), nil
+		}
+	}
+	return value, nil
+}
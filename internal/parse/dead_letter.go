@@ -0,0 +1,77 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Policies for rows that fail validation, e.g. a missing required field
+const (
+	policyFail       = "fail"
+	policySkip       = "skip"
+	policyDeadLetter = "dead_letter"
+)
+
+// defaultDeadLetterPath is the dead-letter file name inside the output location
+const defaultDeadLetterPath = "dead_letter.ndjson"
+
+// deadLetterEntry is one line of the dead-letter file
+type deadLetterEntry struct {
+	Table       string                 `json:"table"`
+	Error       string                 `json:"error"`
+	SourceFile  string                 `json:"source_file"`
+	RecordIndex int64                  `json:"source_record_index"`
+	Record      map[string]interface{} `json:"record"`
+}
+
+// DeadLetterWriter writes rejected rows as NDJSON. The file is only created once the
+// first row is rejected.
+type DeadLetterWriter struct {
+	store    OutputStore
+	name     string
+	out      OutputFile
+	encoder  *json.Encoder
+	location string
+	count    int64
+}
+
+// NewDeadLetterWriter creates a dead-letter writer for the file name in store
+func NewDeadLetterWriter(store OutputStore, name string) *DeadLetterWriter {
+	if name == "" {
+		name = defaultDeadLetterPath
+	}
+	return &DeadLetterWriter{store: store, name: name}
+}
+
+// Write appends a rejected row together with the reason and its provenance
+func (dl *DeadLetterWriter) Write(entry deadLetterEntry) error {
+	if dl.out == nil {
+		out, err := dl.store.Create(dl.name)
+		if err != nil {
+			return fmt.Errorf("failed to create dead-letter file: %w", err)
+		}
+		dl.out = out
+		dl.encoder = json.NewEncoder(out)
+		dl.location = dl.store.Location(dl.name)
+	}
+
+	if err := dl.encoder.Encode(entry); err != nil {
+		return fmt.Errorf("failed to write dead-letter row: %w", err)
+	}
+	dl.count++
+	return nil
+}
+
+// Close finalizes the dead-letter file, if any row was written
+func (dl *DeadLetterWriter) Close() error {
+	if dl.out == nil {
+		return nil
+	}
+	if err := dl.out.Close(); err != nil {
+		return fmt.Errorf("failed to close dead-letter file: %w", err)
+	}
+
+	log.Warnf("Dead-lettered %d rows to %s", dl.count, dl.location)
+	dl.out = nil
+	return nil
+}
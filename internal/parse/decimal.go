@@ -0,0 +1,211 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/segmentio/parquet-go"
+)
+
+// maxDecimalPrecision is the largest precision accepted for decimal(p,s) columns
+const maxDecimalPrecision = 38
+
+// Overflow policies for decimal values that do not fit the column precision
+const (
+	overflowError = "error"
+	overflowNull  = "null"
+	overflowClamp = "clamp"
+)
+
+// decimalSpec returns the precision and scale of a "decimal(p,s)" field
+func decimalSpec(field models.FieldConfig) (int, int, error) {
+	_, args := splitType(field.Type)
+	parts := strings.Split(args, ",")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("field %s: decimal type must be decimal(precision,scale), got %q", field.Name, field.Type)
+	}
+
+	precision, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("field %s: invalid decimal precision in %q", field.Name, field.Type)
+	}
+	scale, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return 0, 0, fmt.Errorf("field %s: invalid decimal scale in %q", field.Name, field.Type)
+	}
+
+	if precision < 1 || precision > maxDecimalPrecision {
+		return 0, 0, fmt.Errorf("field %s: decimal precision must be between 1 and %d, got %d", field.Name, maxDecimalPrecision, precision)
+	}
+	if scale < 0 || scale > precision {
+		return 0, 0, fmt.Errorf("field %s: decimal scale must be between 0 and the precision, got %d", field.Name, scale)
+	}
+	return precision, scale, nil
+}
+
+// overflowPolicy returns the field's on_overflow policy
+func overflowPolicy(field models.FieldConfig) (string, error) {
+	switch policy := strings.ToLower(field.OnOverflow); policy {
+	case "":
+		return overflowError, nil
+	case overflowError, overflowNull, overflowClamp:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("field %s: unknown on_overflow policy %q (expected error, null or clamp)", field.Name, field.OnOverflow)
+	}
+}
+
+// validateDecimalFields checks the type arguments and overflow policy of every decimal column
+func validateDecimalFields(fields []models.FieldConfig) error {
+	for _, field := range fields {
+		if baseType(field.Type) != "decimal" {
+			continue
+		}
+		if _, _, err := decimalSpec(field); err != nil {
+			return err
+		}
+		if _, err := overflowPolicy(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decimalReflectType picks the physical type for a precision:
+// INT32 up to 9 digits, INT64 up to 18 and a fixed length byte array beyond
+func decimalReflectType(precision int) reflect.Type {
+	switch {
+	case precision <= 9:
+		return reflect.TypeOf(int32(0))
+	case precision <= 18:
+		return reflect.TypeOf(int64(0))
+	default:
+		return reflect.ArrayOf(decimalByteLength(precision), reflect.TypeOf(byte(0)))
+	}
+}
+
+// decimalPhysicalType is the parquet type matching decimalReflectType
+func decimalPhysicalType(precision int) parquet.Type {
+	switch {
+	case precision <= 9:
+		return parquet.Int32Type
+	case precision <= 18:
+		return parquet.Int64Type
+	default:
+		return parquet.FixedLenByteArrayType(decimalByteLength(precision))
+	}
+}
+
+// decimalByteLength is the number of bytes needed to hold any unscaled value of the precision
+func decimalByteLength(precision int) int {
+	return int(math.Ceil((math.Log10(2) + float64(precision)) / math.Log10(256)))
+}
+
+// convertDecimal converts a JSON number (or numeric string) into the unscaled *big.Int of the column.
+// Numbers are read from their decimal text, never through float64. Extra fractional digits are
+// rounded half away from zero; values exceeding the precision follow the on_overflow policy.
+// Values that are not numbers yield nil.
+func convertDecimal(value interface{}, field models.FieldConfig) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	precision, scale, err := decimalSpec(field)
+	if err != nil {
+		return nil, err
+	}
+
+	var text string
+	var rat *big.Rat
+	switch v := value.(type) {
+	case *big.Rat:
+		// Exact result of a computed column
+		rat, text = new(big.Rat).Set(v), v.FloatString(scale)
+	case json.Number:
+		text = v.String()
+	case string:
+		text = strings.TrimSpace(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case int:
+		text = strconv.Itoa(v)
+	default:
+		log.Debugf("field %s: expected a decimal number, got %T", field.Name, value)
+		return nil, nil
+	}
+
+	if rat == nil {
+		var ok bool
+		if rat, ok = new(big.Rat).SetString(text); !ok {
+			log.Debugf("field %s: invalid decimal value %q", field.Name, text)
+			return nil, nil
+		}
+	}
+
+	unscaled := roundRat(rat.Mul(rat, new(big.Rat).SetInt(pow10(scale))))
+
+	limit := pow10(precision)
+	if unscaled.CmpAbs(limit) < 0 {
+		return unscaled, nil
+	}
+
+	policy, err := overflowPolicy(field)
+	if err != nil {
+		return nil, err
+	}
+	switch policy {
+	case overflowNull:
+		log.Debugf("field %s: %s exceeds decimal(%d,%d), writing null", field.Name, text, precision, scale)
+		return nil, nil
+	case overflowClamp:
+		max := limit.Sub(limit, big.NewInt(1))
+		if unscaled.Sign() < 0 {
+			return max.Neg(max), nil
+		}
+		return max, nil
+	default:
+		return nil, fmt.Errorf("field %s: value %s exceeds decimal(%d,%d)", field.Name, text, precision, scale)
+	}
+}
+
+// roundRat rounds to the nearest integer, halves away from zero
+func roundRat(r *big.Rat) *big.Int {
+	num := new(big.Int).Abs(r.Num())
+	quo, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		quo.Add(quo, big.NewInt(1))
+	}
+	if r.Sign() < 0 {
+		quo.Neg(quo)
+	}
+	return quo
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// setDecimal stores an unscaled value in an INT32, INT64 or fixed length byte array field
+func setDecimal(field reflect.Value, unscaled *big.Int) {
+	switch field.Kind() {
+	case reflect.Int32, reflect.Int64:
+		field.SetInt(unscaled.Int64())
+	case reflect.Array:
+		// big-endian two's complement over the full array width
+		n := field.Len()
+		v := new(big.Int).Set(unscaled)
+		if v.Sign() < 0 {
+			v.Add(v, new(big.Int).Lsh(big.NewInt(1), uint(8*n)))
+		}
+		reflect.Copy(field, reflect.ValueOf(v.FillBytes(make([]byte, n))))
+	}
+}
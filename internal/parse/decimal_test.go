@@ -0,0 +1,71 @@
+package parse
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecimalOnOverflow(t *testing.T) {
+	tests := []struct {
+		policy  string
+		wantErr bool
+	}{
+		{policy: "error", wantErr: true},
+		{policy: `"null"`},
+		{policy: "clamp"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "in.json")
+			output := filepath.Join(dir, "out")
+			// The overflowing amount sits between two valid rows of the same record
+			writeFile(t, input, `[{"items": [{"amt": 1.5}, {"amt": 123456.78}, {"amt": 2.25}]}]`)
+			config := filepath.Join(dir, "config.yaml")
+			writeFile(t, config, `
+source: {type: file, path: `+input+`}
+output_path: `+output+`
+tables:
+  - name: items
+    json_path: items
+    fields:
+      - {name: amt, json_path: amt, type: "decimal(5,2)", on_overflow: `+tt.policy+`}
+`)
+
+			gp, err := NewGenericParser(config)
+			if err != nil {
+				t.Fatalf("NewGenericParser: %v", err)
+			}
+			err = gp.ParseFile(input)
+			files, _ := filepath.Glob(filepath.Join(output, "*.parquet"))
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("ParseFile: %v", err)
+				}
+				if len(files) != 1 {
+					t.Fatalf("got %d output files, want 1", len(files))
+				}
+				return
+			}
+
+			var convErr *ConversionError
+			if !errors.As(err, &convErr) || !strings.Contains(err.Error(), "exceeds decimal(5,2)") {
+				t.Fatalf("ParseFile error = %v, want a decimal overflow", err)
+			}
+			if len(files) != 0 {
+				t.Fatalf("a failed run left %v behind", files)
+			}
+		})
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,144 @@
+package parse
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Input compression codecs understood by the parser
+const (
+	compressionNone  = "none"
+	compressionGzip  = "gzip"
+	compressionZstd  = "zstd"
+	compressionBzip2 = "bzip2"
+	compressionXz    = "xz"
+)
+
+// compressionExtensions maps file extensions to input compression codecs
+var compressionExtensions = map[string]string{
+	".gz":   compressionGzip,
+	".gzip": compressionGzip,
+	".zst":  compressionZstd,
+	".zstd": compressionZstd,
+	".bz2":  compressionBzip2,
+	".xz":   compressionXz,
+}
+
+// normalizeCompression maps a configured codec or Content-Encoding value to a known codec.
+// It returns an empty string when the value is empty.
+func normalizeCompression(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return "", nil
+	case "none", "identity":
+		return compressionNone, nil
+	case "gzip", "gz", "x-gzip":
+		return compressionGzip, nil
+	case "zstd", "zst":
+		return compressionZstd, nil
+	case "bzip2", "bz2", "x-bzip2":
+		return compressionBzip2, nil
+	case "xz", "x-xz":
+		return compressionXz, nil
+	default:
+		return "", fmt.Errorf("unsupported input compression '%s'", value)
+	}
+}
+
+// resolveCompression picks the input codec from, in order: the explicit source config,
+// the Content-Encoding reported by the fetcher, and the file extension.
+func resolveCompression(configured, contentEncoding, path string) (string, error) {
+	for _, value := range []string{configured, contentEncoding} {
+		codec, err := normalizeCompression(value)
+		if err != nil {
+			return "", err
+		}
+		if codec != "" {
+			return codec, nil
+		}
+	}
+
+	if codec, ok := compressionExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+		return codec, nil
+	}
+	return compressionNone, nil
+}
+
+// trimCompressionExt strips a trailing compression extension, e.g. "a.jsonl.zst" → "a.jsonl"
+func trimCompressionExt(path string) string {
+	ext := filepath.Ext(path)
+	if _, ok := compressionExtensions[strings.ToLower(ext)]; ok {
+		return strings.TrimSuffix(path, ext)
+	}
+	return path
+}
+
+// openInput opens a local input file and wraps it in a streaming decompressor if needed
+func openInput(path, codec string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source file: %w", err)
+	}
+
+	var r io.Reader
+	var closer func() error
+
+	switch codec {
+	case compressionNone:
+		return f, nil
+	case compressionGzip:
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		r, closer = gz, gz.Close
+	case compressionZstd:
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to open zstd stream: %w", err)
+		}
+		r, closer = zr, func() error { zr.Close(); return nil }
+	case compressionBzip2:
+		r = bzip2.NewReader(f)
+	case compressionXz:
+		xr, err := xz.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to open xz stream: %w", err)
+		}
+		r = xr
+	default:
+		f.Close()
+		return nil, fmt.Errorf("unsupported input compression '%s'", codec)
+	}
+
+	return &decompressReader{Reader: r, file: f, closer: closer}, nil
+}
+
+// decompressReader closes both the decompressor and the underlying file
+type decompressReader struct {
+	io.Reader
+	file   *os.File
+	closer func() error
+}
+
+func (d *decompressReader) Close() error {
+	var err error
+	if d.closer != nil {
+		err = d.closer()
+	}
+	if cerr := d.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
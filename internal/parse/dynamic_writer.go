@@ -2,9 +2,11 @@ package parse
 
 import (
 	"fmt"
+	"math/big"
 	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/kweheliye/json2parquet/models"
 	"github.com/kweheliye/json2parquet/utils"
@@ -13,35 +15,54 @@ import (
 
 var log = utils.GetLogger()
 
-// DynamicWriter handles writing records with dynamically generated schemas
+// DynamicWriter handles writing records with dynamically generated schemas.
+// Output rolls over to a new file once the configured rows or bytes per file are reached.
 type DynamicWriter struct {
-	file        *os.File
+	store       OutputStore
+	baseName    string
+	out         *countingOutput
+	location    string
 	writer      *parquet.Writer
 	tableConfig models.TableConfig
 	structType  reflect.Type
+	schema      *parquet.Schema
 	recordCount int64
+	options     WriterOptions
+
+	// Size of the row group currently being buffered
+	groupRows  int64
+	groupBytes int64
+	groupCount int
+
+	// Current file, the locations of the files completed so far, and the store names of the
+	// files no longer open, which Abort removes
+	fileIndex int
+	fileRows  int64
+	files     []string
+	names     []string
+
+	// quiet logs the per-writer summary at debug level, used for partition writers
+	quiet bool
 }
 
-// NewDynamicWriter creates a new writer with dynamic schema
-func NewDynamicWriter(outputPath string, tableConfig models.TableConfig, compression string) (*DynamicWriter, error) {
-	// Create output file
-	file, err := os.Create(outputPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create output file: %w", err)
+// NewDynamicWriter creates a new writer with dynamic schema. Files are created in store and
+// named after baseName, using options.FilenameTemplate when rolling is enabled.
+func NewDynamicWriter(store OutputStore, baseName string, tableConfig models.TableConfig, options WriterOptions) (*DynamicWriter, error) {
+	if options.numbered() && strings.Count(options.FilenameTemplate, "%") != 1 {
+		return nil, fmt.Errorf("filename_template %q must contain exactly one verb for the file number", options.FilenameTemplate)
+	}
+	if err := validateNestedFields(getAllFields(tableConfig)); err != nil {
+		return nil, err
 	}
 
-	// Generate struct type dynamically
-	structType := generateStructType(tableConfig)
-
-	// Create schema from the struct type
-	schema := parquet.SchemaOf(reflect.New(structType).Interface())
+	structType, schema := tableSchema(tableConfig)
 
 	// Create Parquet writer with compression
 	writerConfig, _ := parquet.NewWriterConfig()
 	writerConfig.Schema = schema
 
 	// Set compression
-	switch compression {
+	switch options.Compression {
 	case "zstd":
 		writerConfig.Compression = &parquet.Zstd
 	case "snappy":
@@ -52,18 +73,96 @@ func NewDynamicWriter(outputPath string, tableConfig models.TableConfig, compres
 		writerConfig.Compression = &parquet.Uncompressed
 	}
 
-	writer := parquet.NewWriter(file, writerConfig)
-
-	return &DynamicWriter{
-		file:        file,
-		writer:      writer,
+	dw := &DynamicWriter{
+		store:       store,
+		baseName:    baseName,
 		tableConfig: tableConfig,
 		structType:  structType,
-	}, nil
+		schema:      schema,
+		options:     options,
+		fileIndex:   options.FirstFileIndex,
+	}
+	if err := dw.openFile(); err != nil {
+		return nil, err
+	}
+	dw.writer = parquet.NewWriter(dw.out, writerConfig)
+
+	return dw, nil
+}
+
+// fileName returns the name of the file with the given sequence number
+func (dw *DynamicWriter) fileName(index int) string {
+	if !dw.options.numbered() {
+		return dw.baseName + ".parquet"
+	}
+	return dw.baseName + fmt.Sprintf(dw.options.FilenameTemplate, index)
+}
+
+// openFile creates the output file for the current file index
+func (dw *DynamicWriter) openFile() error {
+	name := dw.fileName(dw.fileIndex)
+	out, err := dw.store.Create(name)
+	if err != nil {
+		return err
+	}
+	dw.out = &countingOutput{OutputFile: out}
+	dw.location = dw.store.Location(name)
+	dw.fileRows = 0
+	return nil
+}
+
+// closeFile finalizes the current file and records it
+func (dw *DynamicWriter) closeFile() error {
+	if err := dw.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close writer: %w", err)
+	}
+
+	if err := dw.out.Close(); err != nil {
+		// The file cannot be aborted once closed; Abort removes whatever was left of it
+		dw.names = append(dw.names, dw.fileName(dw.fileIndex))
+		dw.out = nil
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+
+	dw.files = append(dw.files, dw.location)
+	dw.names = append(dw.names, dw.fileName(dw.fileIndex))
+	dw.groupRows, dw.groupBytes = 0, 0
+	log.Debugf("Completed %s (%d rows, %d bytes)", dw.location, dw.fileRows, dw.out.written)
+	dw.out = nil
+	return nil
+}
+
+// maybeRollFile starts a new file once the current one holds the configured rows or bytes.
+// Bytes are counted as they reach the output, i.e. at row group boundaries.
+func (dw *DynamicWriter) maybeRollFile() error {
+	full := (dw.options.MaxRowsPerFile > 0 && dw.fileRows >= dw.options.MaxRowsPerFile) ||
+		(dw.options.MaxBytesPerFile > 0 && dw.out.written >= dw.options.MaxBytesPerFile)
+	if !full {
+		return nil
+	}
+
+	if err := dw.closeFile(); err != nil {
+		return err
+	}
+	dw.fileIndex++
+	if err := dw.openFile(); err != nil {
+		return err
+	}
+	dw.writer.Reset(dw.out)
+	return nil
+}
+
+// Files returns the locations of the files completed so far, in order
+func (dw *DynamicWriter) Files() []string {
+	return dw.files
 }
 
 // Write writes a generic record
 func (dw *DynamicWriter) Write(record models.GenericRecord) error {
+	if err := dw.maybeRollFile(); err != nil {
+		return err
+	}
+
 	// Create new struct instance
 	instance := reflect.New(dw.structType).Elem()
 
@@ -78,15 +177,15 @@ func (dw *DynamicWriter) Write(record models.GenericRecord) error {
 		fieldValue := instance.Field(i)
 
 		if value, ok := record[field.Name]; ok && value != nil {
-			dw.setFieldValue(fieldValue, value, field.Type)
+			dw.setFieldValue(fieldValue, value, field)
 		}
 	}
 
 	// Write to Parquet
-	row := parquet.Row{}
-	for i := 0; i < instance.NumField(); i++ {
-		field := instance.Field(i)
-		row = append(row, parquet.ValueOf(field.Interface()))
+	row := dw.schema.Deconstruct(nil, instance.Addr().Interface())
+	var rowBytes int64
+	for _, value := range row {
+		rowBytes += estimatedSize(value)
 	}
 
 	if _, err := dw.writer.WriteRows([]parquet.Row{row}); err != nil {
@@ -94,30 +193,72 @@ func (dw *DynamicWriter) Write(record models.GenericRecord) error {
 	}
 
 	dw.recordCount++
+	dw.fileRows++
+	dw.groupRows++
+	dw.groupBytes += rowBytes
+
+	return dw.maybeFlushRowGroup()
+}
+
+// maybeFlushRowGroup ends the current row group once it reaches the configured rows or bytes
+func (dw *DynamicWriter) maybeFlushRowGroup() error {
+	full := (dw.options.MaxRowsPerGroup > 0 && dw.groupRows >= dw.options.MaxRowsPerGroup) ||
+		(dw.options.MaxBytesPerGroup > 0 && dw.groupBytes >= dw.options.MaxBytesPerGroup)
+	if !full {
+		return nil
+	}
+
+	if err := dw.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush row group: %w", err)
+	}
+	log.Debugf("Flushed row group %d of table %s (%d rows, ~%d bytes)", dw.groupCount, dw.tableConfig.Name, dw.groupRows, dw.groupBytes)
+
+	dw.groupCount++
+	dw.groupRows = 0
+	dw.groupBytes = 0
 	return nil
 }
 
-// setFieldValue sets a reflect.Value based on the target type
-func (dw *DynamicWriter) setFieldValue(field reflect.Value, value interface{}, targetType string) {
+// setFieldValue sets a reflect.Value based on the target type, allocating nullable columns
+func (dw *DynamicWriter) setFieldValue(field reflect.Value, value interface{}, fieldConfig models.FieldConfig) {
 	if !field.CanSet() {
 		return
 	}
 
-	switch targetType {
-	case "string":
+	if field.Kind() == reflect.Ptr {
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+
+	if nestedKind(fieldConfig.Type) != "" {
+		dw.setNestedValue(field, value, fieldConfig)
+		return
+	}
+
+	if isTemporal(fieldConfig) {
+		if t, ok := value.(time.Time); ok {
+			field.SetInt(temporalToInt(t, fieldConfig))
+		}
+		return
+	}
+
+	if baseType(fieldConfig.Type) == "decimal" {
+		if unscaled, ok := value.(*big.Int); ok {
+			setDecimal(field, unscaled)
+		}
+		return
+	}
+
+	switch fieldConfig.Type {
+	case "string", "json":
 		field.SetString(fmt.Sprintf("%v", value))
-	case "int64":
-		switch v := value.(type) {
-		case float64:
-			field.SetInt(int64(v))
-		case int:
-			field.SetInt(int64(v))
-		case int64:
+	case "int64", "int32", "int16", "int8":
+		if v, ok := value.(int64); ok {
 			field.SetInt(v)
-		case int32:
-			field.SetInt(int64(v))
-		default:
-			field.SetInt(0)
+		}
+	case "uint64":
+		if v, ok := value.(uint64); ok {
+			field.SetUint(v)
 		}
 	case "float64":
 		switch v := value.(type) {
@@ -141,30 +282,81 @@ func (dw *DynamicWriter) setFieldValue(field reflect.Value, value interface{}, t
 	}
 }
 
-// Close closes the writer
+// Close finalizes the current file
 func (dw *DynamicWriter) Close() error {
-	if err := dw.writer.Close(); err != nil {
-		return fmt.Errorf("failed to close writer: %w", err)
+	if err := dw.closeFile(); err != nil {
+		return err
 	}
 
-	if err := dw.file.Close(); err != nil {
-		return fmt.Errorf("failed to close file: %w", err)
+	logf := log.Infof
+	if dw.quiet {
+		logf = log.Debugf
+	}
+	if len(dw.files) == 1 {
+		logf("Wrote %d records to table: %s (%s)", dw.recordCount, dw.tableConfig.Name, dw.location)
+	} else {
+		logf("Wrote %d records to table: %s (%d files: %s)", dw.recordCount, dw.tableConfig.Name, len(dw.files), strings.Join(dw.files, ", "))
 	}
+	return nil
+}
 
-	log.Infof("Wrote %d records to table: %s", dw.recordCount, dw.tableConfig.Name)
+// Abort discards the partially written current file, e.g. aborting an incomplete multipart upload,
+// and removes the files completed by earlier rollovers (or by Close), so a failed run leaves no output
+func (dw *DynamicWriter) Abort() error {
+	var firstErr error
+	if dw.out != nil {
+		if err := dw.out.Abort(); err != nil {
+			firstErr = fmt.Errorf("failed to abort %s: %w", dw.location, err)
+		}
+		dw.out = nil
+	}
+	for _, name := range dw.names {
+		if err := dw.store.Remove(name); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove %s: %w", dw.store.Location(name), err)
+		}
+	}
+	dw.files, dw.names = nil, nil
+	if firstErr != nil {
+		return firstErr
+	}
+
+	logf := log.Warnf
+	if dw.quiet {
+		logf = log.Debugf
+	}
+	logf("Discarded output for table: %s (%s)", dw.tableConfig.Name, dw.location)
 	return nil
 }
 
 // generateStructType dynamically generates a struct type from table config
 func generateStructType(tableConfig models.TableConfig) reflect.Type {
-	allFields := getAllFields(tableConfig)
+	return structTypeOf(getAllFields(tableConfig))
+}
+
+// tableSchema returns the row struct type of a table and the Parquet schema derived from it
+func tableSchema(tableConfig models.TableConfig) (reflect.Type, *parquet.Schema) {
+	// Generate struct type dynamically
+	structType := generateStructType(tableConfig)
+
+	// Create schema from the struct type
+	return structType, withLogicalTypes(parquet.SchemaOf(reflect.New(structType).Interface()), getAllFields(tableConfig))
+}
 
+// structTypeOf generates a struct type with one field per column, also used for struct columns
+func structTypeOf(fieldConfigs []models.FieldConfig) reflect.Type {
 	var fields []reflect.StructField
 
-	for _, fieldConfig := range allFields {
+	for _, fieldConfig := range fieldConfigs {
+		// Columns are OPTIONAL so missing values are written as null, unless the field is required.
+		// Lists and maps are null when nil and need no pointer.
+		fieldType := getReflectType(fieldConfig)
+		if !fieldConfig.Required && fieldType.Kind() != reflect.Slice && fieldType.Kind() != reflect.Map {
+			fieldType = reflect.PointerTo(fieldType)
+		}
+
 		field := reflect.StructField{
 			Name: toExportedName(fieldConfig.Name),
-			Type: getReflectType(fieldConfig.Type),
+			Type: fieldType,
 			Tag:  reflect.StructTag(generateParquetTag(fieldConfig)),
 		}
 		fields = append(fields, field)
@@ -173,7 +365,7 @@ func generateStructType(tableConfig models.TableConfig) reflect.Type {
 	return reflect.StructOf(fields)
 }
 
-// getAllFields combines parent ref fields and table fields
+// getAllFields combines parent ref fields, table fields and provenance fields
 func getAllFields(tableConfig models.TableConfig) []models.FieldConfig {
 	var allFields []models.FieldConfig
 
@@ -185,6 +377,9 @@ func getAllFields(tableConfig models.TableConfig) []models.FieldConfig {
 	// Add table's own fields
 	allFields = append(allFields, tableConfig.Fields...)
 
+	// Add injected provenance fields last
+	allFields = append(allFields, tableConfig.Provenance...)
+
 	return allFields
 }
 
@@ -206,13 +401,44 @@ func toExportedName(name string) string {
 	return result
 }
 
-// getReflectType returns the reflect.Type for a type string
-func getReflectType(typeStr string) reflect.Type {
-	switch typeStr {
-	case "string":
+// getReflectType returns the reflect.Type for a field type
+func getReflectType(field models.FieldConfig) reflect.Type {
+	if nestedKind(field.Type) != "" {
+		return nestedReflectType(field)
+	}
+
+	switch baseType(field.Type) {
+	case "timestamp":
+		return reflect.TypeOf(int64(0))
+	case "date":
+		return reflect.TypeOf(int32(0))
+	case "time":
+		// TIME(MILLIS) is stored as INT32, finer units as INT64
+		if timeUnitOf(field) == unitMillis {
+			return reflect.TypeOf(int32(0))
+		}
+		return reflect.TypeOf(int64(0))
+	case "decimal":
+		precision, _, err := decimalSpec(field)
+		if err != nil {
+			return reflect.TypeOf("")
+		}
+		return decimalReflectType(precision)
+	}
+
+	switch field.Type {
+	case "string", "json":
 		return reflect.TypeOf("")
 	case "int64":
 		return reflect.TypeOf(int64(0))
+	case "int32":
+		return reflect.TypeOf(int32(0))
+	case "int16":
+		return reflect.TypeOf(int16(0))
+	case "int8":
+		return reflect.TypeOf(int8(0))
+	case "uint64":
+		return reflect.TypeOf(uint64(0))
 	case "float64":
 		return reflect.TypeOf(float64(0))
 	case "bool":
@@ -222,7 +448,11 @@ func getReflectType(typeStr string) reflect.Type {
 	}
 }
 
-// generateParquetTag generates the parquet struct tag
+// generateParquetTag generates the parquet struct tag. Logical types that tags cannot
+// express on nullable columns are applied by withLogicalTypes.
 func generateParquetTag(field models.FieldConfig) string {
+	if nestedKind(field.Type) == kindList {
+		return fmt.Sprintf(`parquet:"%s,list"`, field.Name)
+	}
 	return fmt.Sprintf(`parquet:"%s"`, field.Name)
 }
@@ -0,0 +1,218 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/internal/jsonpath"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// rootEntityKey is the entity key of tables reading the root records
+const rootEntityKey = "$"
+
+// tableTree is the traversal order of the tables. Top level tables are evaluated against every
+// root record, child tables against every row object of their parent table.
+type tableTree struct {
+	// order lists the tables in processing order: a table comes after its parent and after
+	// every table whose nodes enclose its own, so the rows they wrote are known when it binds them
+	order    []models.TableConfig
+	children map[string][]models.TableConfig
+
+	// keys holds each table's entity key: the rooted path of the nodes it reads, with the
+	// relative paths of child tables joined to their parent's key
+	keys map[string]string
+
+	// byName indexes tables by name and alias
+	byName map[string]models.TableConfig
+
+	// entities groups tables by entity key, so that the array elements entered while
+	// traversing a table's path can be bound to the ancestor tables reading them
+	entities map[string][]models.TableConfig
+}
+
+// buildTableTree resolves parent tables and entity keys, then validates parent_refs
+func buildTableTree(config *models.ParseConfig) (*tableTree, error) {
+	byName, err := tablesByName(config)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &tableTree{
+		byName:   byName,
+		children: make(map[string][]models.TableConfig),
+		keys:     make(map[string]string),
+		entities: make(map[string][]models.TableConfig),
+	}
+
+	for _, tableConfig := range config.Tables {
+		if tableConfig.Parent == "" {
+			continue
+		}
+		parent, ok := byName[tableConfig.Parent]
+		if !ok {
+			return nil, fmt.Errorf("table %s: parent %q does not match a table name or alias", tableConfig.Name, tableConfig.Parent)
+		}
+		tree.children[parent.Name] = append(tree.children[parent.Name], tableConfig)
+	}
+
+	for _, tableConfig := range config.Tables {
+		key, err := resolveEntityKey(tableConfig, byName, tree.keys, nil)
+		if err != nil {
+			return nil, err
+		}
+		tree.entities[key] = append(tree.entities[key], tableConfig)
+	}
+
+	if err := validateParentRefs(config, byName, tree.keys); err != nil {
+		return nil, err
+	}
+	tree.order = processingOrder(config, byName, tree.keys)
+	return tree, nil
+}
+
+// processingOrder sorts the tables by the depth of their entity key, which puts enclosing
+// tables first, and moves every parent before its children
+func processingOrder(config *models.ParseConfig, byName map[string]models.TableConfig, keys map[string]string) []models.TableConfig {
+	byDepth := append([]models.TableConfig(nil), config.Tables...)
+	sort.SliceStable(byDepth, func(i, j int) bool {
+		return len(keys[byDepth[i].Name]) < len(keys[byDepth[j].Name])
+	})
+
+	order := make([]models.TableConfig, 0, len(byDepth))
+	placed := make(map[string]bool)
+	var place func(tableConfig models.TableConfig)
+	place = func(tableConfig models.TableConfig) {
+		if placed[tableConfig.Name] {
+			return
+		}
+		placed[tableConfig.Name] = true
+		if tableConfig.Parent != "" {
+			place(byName[tableConfig.Parent])
+		}
+		order = append(order, tableConfig)
+	}
+	for _, tableConfig := range byDepth {
+		place(tableConfig)
+	}
+	return order
+}
+
+// tablesByName indexes tables by name and alias, which must be unique
+func tablesByName(config *models.ParseConfig) (map[string]models.TableConfig, error) {
+	byName := make(map[string]models.TableConfig)
+	for _, tableConfig := range config.Tables {
+		for _, name := range []string{tableConfig.Name, tableConfig.Alias} {
+			if name == "" {
+				continue
+			}
+			if other, ok := byName[name]; ok {
+				return nil, fmt.Errorf("table %s: name or alias %q is already used by table %s", tableConfig.Name, name, other.Name)
+			}
+			byName[name] = tableConfig
+		}
+	}
+	return byName, nil
+}
+
+// resolveEntityKey computes a table's entity key, resolving its parents first
+func resolveEntityKey(tableConfig models.TableConfig, byName map[string]models.TableConfig, keys map[string]string, visiting map[string]bool) (string, error) {
+	if key, ok := keys[tableConfig.Name]; ok {
+		return key, nil
+	}
+
+	base := rootEntityKey
+	if tableConfig.Parent != "" {
+		if visiting[tableConfig.Name] {
+			return "", fmt.Errorf("table %s: parent tables form a cycle", tableConfig.Name)
+		}
+		if visiting == nil {
+			visiting = make(map[string]bool)
+		}
+		visiting[tableConfig.Name] = true
+
+		var err error
+		base, err = resolveEntityKey(byName[tableConfig.Parent], byName, keys, visiting)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	path := pathOf(tableConfig.JSONPath)
+	key := joinEntityKey(base, path, path.Len())
+	keys[tableConfig.Name] = key
+	return key, nil
+}
+
+// joinEntityKey appends the key of the first n segments of path, relative to the nodes of
+// base, to base. Element selectors are left out, so "projects", "projects[*]", "projects[0]"
+// and "projects[?(@.active)]" all read project objects.
+func joinEntityKey(base string, path *jsonpath.Path, n int) string {
+	return base + strings.TrimPrefix(path.Key(n), rootEntityKey)
+}
+
+// isAncestorKey reports whether the nodes of key enclose the nodes of child
+func isAncestorKey(key, child string) bool {
+	if key == rootEntityKey {
+		return child != rootEntityKey
+	}
+	return len(child) > len(key) && strings.HasPrefix(child, key) && strings.ContainsRune(".[", rune(child[len(key)]))
+}
+
+// validateParentRefs checks that every parent_refs entity_name names an ancestor table,
+// i.e. one whose nodes enclose the referencing table's nodes
+func validateParentRefs(config *models.ParseConfig, byName map[string]models.TableConfig, keys map[string]string) error {
+	for _, tableConfig := range config.Tables {
+		key := keys[tableConfig.Name]
+		for _, parentRef := range tableConfig.ParentRefs {
+			parent, ok := byName[parentRef.EntityName]
+			if !ok {
+				return fmt.Errorf("table %s: parent_refs entity_name %q does not match a table name or alias", tableConfig.Name, parentRef.EntityName)
+			}
+			if !isAncestorKey(keys[parent.Name], key) {
+				return fmt.Errorf("table %s: parent_refs entity_name %q: table %s (json_path %q) does not enclose json_path %q",
+					tableConfig.Name, parentRef.EntityName, parent.Name, parent.JSONPath, tableConfig.JSONPath)
+			}
+		}
+	}
+	return nil
+}
+
+// contextWithEntity returns a cloned context with the entity bound under the table's name and alias
+func contextWithEntity(ctx map[string]interface{}, tableConfig models.TableConfig, entity map[string]interface{}) map[string]interface{} {
+	next := cloneMap(ctx)
+	next[tableConfig.Name] = entity
+	if tableConfig.Alias != "" {
+		next[tableConfig.Alias] = entity
+	}
+	return next
+}
+
+// contextWithTrail binds the array elements entered on the way to a table's rows to the
+// tables that wrote them as rows. An element a table did not select, or dropped by its where
+// predicate or required_policy, is not bound to it. base is the entity key the path is evaluated from and baseIndexes the
+// array indexes leading to it; the indexes leading to the last trail element are returned.
+func (gp *GenericParser) contextWithTrail(ctx map[string]interface{}, base string, path *jsonpath.Path, trail []jsonpath.Trail, baseIndexes []int) (map[string]interface{}, []int) {
+	indexes := baseIndexes
+	for _, t := range trail {
+		indexes = append(indexes[:len(indexes):len(indexes)], t.Index)
+		entity, ok := t.Value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		gp.setPosition(entity, indexes)
+		for _, tableConfig := range gp.tables.entities[joinEntityKey(base, path, t.Depth)] {
+			if gp.wrote(tableConfig, entity) {
+				ctx = contextWithEntity(ctx, tableConfig, entity)
+			}
+		}
+	}
+	return ctx, indexes
+}
+
+// objectID identifies a decoded JSON object, so that a table visits each object once
+func objectID(obj map[string]interface{}) uintptr {
+	return reflect.ValueOf(obj).Pointer()
+}
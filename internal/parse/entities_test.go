@@ -0,0 +1,158 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// traversalRecord holds three projects; the second has no owner
+const traversalRecord = `{"org": "acme", "projects": [
+	{"id": 1, "status": "active", "owner": "ana", "tasks": [{"id": 11}, {"id": 12}]},
+	{"id": 2, "status": "on_hold", "tasks": [{"id": 21}]},
+	{"id": 3, "status": "archived", "owner": "li", "tasks": [{"id": 31}]}
+]}`
+
+// tasksTable is a tasks table binding project_id through parent_refs to the table named by
+// entity; settings are added to the table, e.g. its json_path
+func tasksTable(entity, settings string) string {
+	return `
+  - name: tasks
+    ` + settings + `
+    fields:
+      - {name: id, json_path: id, type: int64}
+    parent_refs:
+      - entity_name: ` + entity + `
+        fields:
+          - {name: project_id, json_path: id, type: int64}
+`
+}
+
+func TestTraversal(t *testing.T) {
+	tests := []struct {
+		name   string
+		tables string
+		tasks  []string // id and project_id of the tasks written
+	}{
+		{
+			name: "parent relative path",
+			tables: `
+  - name: projects
+    json_path: projects
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("projects", "parent: projects\n    json_path: tasks"),
+			tasks: []string{"11 1", "12 1", "21 2", "31 3"},
+		},
+		{
+			name: "path from the root",
+			tables: `
+  - name: projects
+    json_path: projects
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("projects", "json_path: projects.tasks"),
+			tasks: []string{"11 1", "12 1", "21 2", "31 3"},
+		},
+		{
+			name: "alias and element selectors",
+			tables: `
+  - name: projects
+    alias: project
+    json_path: projects[*]
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("project", "json_path: projects[1:].tasks[*]"),
+			tasks: []string{"21 2", "31 3"},
+		},
+		{
+			name: "each object once",
+			tables: `
+  - name: projects
+    json_path: projects
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("projects", "json_path: projects[0,0].tasks"),
+			tasks: []string{"11 1", "12 1"},
+		},
+		{
+			name: "filter selector parent",
+			tables: `
+  - name: active_projects
+    json_path: projects[?(@.status == 'active')]
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("active_projects", "json_path: projects.tasks"),
+			tasks: []string{"11 1", "12 1", "21 null", "31 null"},
+		},
+		{
+			name: "where parent, tasks from the root",
+			tables: `
+  - name: projects
+    json_path: projects
+    where: "status != 'archived'"
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("projects", "json_path: projects.tasks"),
+			tasks: []string{"11 1", "12 1", "21 2", "31 null"},
+		},
+		{
+			name: "where parent, tasks below it",
+			tables: `
+  - name: projects
+    json_path: projects
+    where: "status != 'archived'"
+    fields: [{name: id, json_path: id, type: int64}]` + tasksTable("projects", "parent: projects\n    json_path: tasks"),
+			tasks: []string{"11 1", "12 1", "21 2"},
+		},
+		{
+			name: "parent rejected by required_policy",
+			tables: `
+  - name: projects
+    json_path: projects
+    required_policy: skip
+    fields:
+      - {name: id, json_path: id, type: int64}
+      - {name: owner, json_path: owner, type: string, required: true}` + tasksTable("projects", "json_path: projects.tasks"),
+			tasks: []string{"11 1", "12 1", "21 null", "31 3"},
+		},
+		{
+			name: "children declared first",
+			tables: tasksTable("projects", "json_path: projects.tasks") + `
+  - name: projects
+    json_path: projects
+    where: "owner is not null"
+    fields: [{name: id, json_path: id, type: int64}]`,
+			tasks: []string{"11 1", "12 1", "21 null", "31 3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gp, rows := newTestParser(t, "tables:"+tt.tables)
+			if err := gp.processRecord(decodeRecord(t, traversalRecord)); err != nil {
+				t.Fatalf("processRecord: %v", err)
+			}
+			got := strings.Join(renderRows(rows["tasks"], "id", "project_id"), ", ")
+			if want := strings.Join(tt.tasks, ", "); got != want {
+				t.Errorf("tasks = [%s], want [%s]", got, want)
+			}
+		})
+	}
+}
+
+func TestRootBinding(t *testing.T) {
+	gp, rows := newTestParser(t, `
+tables:
+  - name: orgs
+    json_path: ""
+    where: "org != 'skip'"
+    fields: [{name: org, json_path: org, type: string}]
+  - name: projects
+    json_path: projects
+    fields: [{name: id, json_path: id, type: int64}]
+    parent_refs:
+      - entity_name: orgs
+        fields: [{name: org, json_path: org, type: string}]
+`)
+	for _, doc := range []string{traversalRecord, `{"org": "skip", "projects": [{"id": 4}]}`} {
+		if err := gp.processRecord(decodeRecord(t, doc)); err != nil {
+			t.Fatalf("processRecord: %v", err)
+		}
+	}
+
+	// A nested object is never a row of the root table, and a filtered root is not bound
+	if got := strings.Join(renderRows(rows["orgs"], "org"), ", "); got != "acme" {
+		t.Errorf("orgs = [%s], want [acme]", got)
+	}
+	got := strings.Join(renderRows(rows["projects"], "id", "org"), ", ")
+	if want := "1 acme, 2 acme, 3 acme, 4 null"; got != want {
+		t.Errorf("projects = [%s], want [%s]", got, want)
+	}
+}
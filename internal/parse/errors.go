@@ -1,6 +1,9 @@
 package parse
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type NotInListError struct {
 	item string
@@ -9,3 +12,46 @@ type NotInListError struct {
 func (e *NotInListError) Error() string {
 	return fmt.Sprintf("%s is not in list", e.item)
 }
+
+// RequiredFieldError reports a row whose required field is missing or could not be converted
+type RequiredFieldError struct {
+	Table string
+	Field string
+}
+
+func (e *RequiredFieldError) Error() string {
+	return fmt.Sprintf("table %s: required field %s is missing", e.Table, e.Field)
+}
+
+// ConversionError reports a value that cannot be converted to its column type, e.g. an
+// integer out of range or an unparseable timestamp. Like a missing required field, the row is
+// rejected by the table's required_policy, which fails the run by default.
+type ConversionError struct {
+	Err error
+}
+
+func (e *ConversionError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigError reports a parse config rejected by validation, with every problem found
+type ConfigError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *ConfigError) Error() string {
+	var lines []string
+	for _, d := range e.Diagnostics {
+		if d.Severity == SeverityError {
+			lines = append(lines, d.String())
+		}
+	}
+	if len(lines) == 1 {
+		return lines[0]
+	}
+	return fmt.Sprintf("%d problems:\n  %s", len(lines), strings.Join(lines, "\n  "))
+}
@@ -2,319 +2,602 @@ package parse
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/kweheliye/json2parquet/internal/expr"
+	"github.com/kweheliye/json2parquet/internal/jsonpath"
 	"github.com/kweheliye/json2parquet/models"
-	"gopkg.in/yaml.v3"
 )
 
 // GenericParser handles parsing of nested JSON based on configuration
 type GenericParser struct {
 	config     *models.ParseConfig
-	writers    map[string]*DynamicWriter
+	writers    map[string]tableWriter
 	writersMux sync.RWMutex
+	store      OutputStore
+
+	// Rows rejected for missing required fields
+	requiredPolicies map[string]string
+	deadLetter       *DeadLetterWriter
+	skipped          map[string]int64
+
+	// Compiled where predicates by table, and the rows they filtered out
+	where    map[string]*expr.Expr
+	filtered map[string]int64
+
+	// Compiled expressions of computed columns by table and column
+	exprs map[string]map[string]*expr.Expr
+
+	// Keys read by each table with capture_unmapped
+	mappedKeys map[string]keySet
+
+	// Traversal order of the tables and the ancestors bound for parent_refs
+	tables *tableTree
+
+	// Rows written from the current root record: the objects each table wrote, which are the
+	// only ones bound to it for the tables below, and the rows of tables with child tables
+	written map[rowRef]bool
+	rows    map[string][]boundRow
+
+	// Surrogate keys: the last row_id written by each table, and the keys of the rows written
+	// from the current root record and the array positions of its objects (nil when no table
+	// has a surrogate key)
+	rowIDs    map[string]int64
+	rowKeys   map[rowRef]interface{}
+	positions map[uintptr][]int
+
+	// Root record currently being processed, and its provenance
+	record      map[string]interface{}
+	sourceFile  string
+	recordIndex int64
+
+	// rowSink receives the rows instead of the table writers when set, used to try a config
+	// on sample data without writing files
+	rowSink func(tableConfig models.TableConfig, record models.GenericRecord) error
 }
 
+// Provenance column names injected into every table when enabled in the source config
+const (
+	sourceFileColumn        = "source_file"
+	sourceRecordIndexColumn = "source_record_index"
+)
+
 // NewGenericParser creates a new generic parser from config file
 func NewGenericParser(configPath string) (*GenericParser, error) {
 	config, err := loadParseConfig(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	return newGenericParser(config)
+}
+
+// newGenericParser prepares a decoded config: paths are compiled, generated columns injected
+// and the table tree built
+func newGenericParser(config *models.ParseConfig) (*GenericParser, error) {
+	if err := compileConfigPaths(config); err != nil {
+		return nil, err
+	}
+	injectProvenance(config)
+	if err := injectUnmapped(config); err != nil {
+		return nil, err
+	}
+	if err := injectSurrogateKeys(config); err != nil {
+		return nil, err
+	}
+
+	tables, err := buildTableTree(config)
+	if err != nil {
+		return nil, err
+	}
+
+	where, err := compileWhere(config, tables)
+	if err != nil {
+		return nil, err
+	}
+	exprs, err := compileExprs(config, tables)
+	if err != nil {
+		return nil, err
+	}
+
+	policies, err := resolveRequiredPolicies(config)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := make(map[string]keySet)
+	for _, tableConfig := range config.Tables {
+		if tableConfig.CaptureUnmapped != "" {
+			mapped[tableConfig.Name] = mappedKeys(tableConfig, tables.keys, exprs[tableConfig.Name])
+		}
+	}
 
-	return &GenericParser{
-		config:  config,
-		writers: make(map[string]*DynamicWriter),
-	}, nil
+	gp := &GenericParser{
+		config:           config,
+		writers:          make(map[string]tableWriter),
+		requiredPolicies: policies,
+		skipped:          make(map[string]int64),
+		where:            where,
+		filtered:         make(map[string]int64),
+		exprs:            exprs,
+		mappedKeys:       mapped,
+		tables:           tables,
+		written:          make(map[rowRef]bool),
+		rows:             make(map[string][]boundRow),
+	}
+	if hasSurrogateKeys(config) {
+		gp.rowIDs = make(map[string]int64)
+		gp.rowKeys = make(map[rowRef]interface{})
+		gp.positions = make(map[uintptr][]int)
+	}
+	return gp, nil
 }
 
-// loadParseConfig loads the parse configuration from YAML file
+// loadParseConfig loads the parse configuration from YAML file. The config is validated first:
+// warnings are logged and errors are returned together as a *ConfigError.
 func loadParseConfig(configPath string) (*models.ParseConfig, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var config models.ParseConfig
-	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	config, diagnostics := decodeParseConfig(configPath, data)
+	for _, d := range diagnostics {
+		if d.Severity == SeverityWarning {
+			log.Warn(d.String())
+		}
+	}
+	if HasErrors(diagnostics) {
+		return nil, &ConfigError{Diagnostics: diagnostics}
+	}
+	return config, nil
+}
+
+// injectProvenance adds the enabled provenance columns to every table
+func injectProvenance(config *models.ParseConfig) {
+	var fields []models.FieldConfig
+	if config.Source.Provenance.SourceFile {
+		fields = append(fields, models.FieldConfig{Name: sourceFileColumn, Type: "string", Required: true})
+	}
+	if config.Source.Provenance.RecordIndex {
+		fields = append(fields, models.FieldConfig{Name: sourceRecordIndexColumn, Type: "int64", Required: true})
+	}
+
+	for i := range config.Tables {
+		config.Tables[i].Provenance = fields
 	}
+}
 
-	return &config, nil
+// resolveRequiredPolicies returns the required_policy of every table, defaulting to the global policy
+func resolveRequiredPolicies(config *models.ParseConfig) (map[string]string, error) {
+	policies := make(map[string]string, len(config.Tables))
+	for _, tableConfig := range config.Tables {
+		policy := tableConfig.RequiredPolicy
+		if policy == "" {
+			policy = config.RequiredPolicy
+		}
+		switch policy {
+		case "":
+			policy = policyFail
+		case policyFail, policySkip, policyDeadLetter:
+		default:
+			return nil, fmt.Errorf("table %s: unknown required_policy %q (expected fail, skip or dead_letter)", tableConfig.Name, policy)
+		}
+		policies[tableConfig.Name] = policy
+	}
+	return policies, nil
 }
 
 // ParseFile processes the provided local JSON file according to configuration
 func (gp *GenericParser) ParseFile(localPath string) error {
+	return gp.ParseFiles([]InputFile{{LocalPath: localPath, Origin: localPath}})
+}
+
+// ParseFiles processes several local files into the same set of table writers
+func (gp *GenericParser) ParseFiles(inputs []InputFile) error {
 	// Initialize writers for each table
 	if err := gp.initializeWriters(); err != nil {
+		gp.abortWriters()
 		return fmt.Errorf("failed to initialize writers: %w", err)
 	}
-	defer gp.closeWriters()
 
-	// Read the JSON file
-	log.Infof("Reading JSON from: %s", localPath)
-	data, err := os.ReadFile(localPath)
-	if err != nil {
-		return fmt.Errorf("failed to read source file: %w", err)
-	}
-	log.Infof("Read %d bytes from JSON file", len(data))
-
-	// Parse JSON into generic structure
-	var jsonData interface{}
-	if err := json.Unmarshal(data, &jsonData); err != nil {
-		return fmt.Errorf("failed to parse JSON: %w", err)
-	}
-	log.Infof("Successfully parsed JSON")
-
-	// Convert to array if needed
-	var records []interface{}
-	switch v := jsonData.(type) {
-	case []interface{}:
-		records = v
-	case map[string]interface{}:
-		if gp.config.Source.RootArray != "" {
-			if arr, ok := v[gp.config.Source.RootArray].([]interface{}); ok {
-				records = arr
-			} else {
-				return fmt.Errorf("root_array '%s' is not an array", gp.config.Source.RootArray)
-			}
-		} else {
-			records = []interface{}{v}
+	total := 0
+	for _, input := range inputs {
+		count, err := gp.parseInput(input)
+		if err != nil {
+			// Don't leave partial output (or incomplete uploads) behind
+			gp.abortWriters()
+			return fmt.Errorf("failed to parse %s: %w", input.Origin, err)
 		}
-	default:
-		return fmt.Errorf("unsupported JSON structure")
+		total += count
+	}
+	if err := gp.closeWriters(); err != nil {
+		return err
+	}
+	for table, count := range gp.skipped {
+		log.Warnf("Skipped %d rows of table %s with missing required fields or invalid values", count, table)
+	}
+	for table, count := range gp.filtered {
+		log.Infof("Filtered out %d rows of table %s by its where predicate", count, table)
+	}
+
+	if len(inputs) > 1 {
+		log.Infof("Successfully parsed %d root records from %d files", total, len(inputs))
+	}
+	return nil
+}
+
+// parseInput streams a single local file through processRecord
+func (gp *GenericParser) parseInput(input InputFile) (int, error) {
+	format, err := resolveFormat(gp.config.Source, input.LocalPath)
+	if err != nil {
+		return 0, err
+	}
+	codec, err := resolveCompression(gp.config.Source.Compression, input.ContentEncoding, input.LocalPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Stream the source one root record at a time, decompressing on the fly
+	log.Infof("Reading %s (compression: %s) from: %s", format, codec, input.LocalPath)
+	f, err := openInput(input.LocalPath, codec)
+	if err != nil {
+		return 0, err
 	}
+	defer f.Close()
 
-	log.Infof("Processing %d root records", len(records))
+	gp.sourceFile = input.Origin
 
-	// Process each record
-	for i, record := range records {
+	handle := func(i int, record interface{}) error {
 		recordMap, ok := record.(map[string]interface{})
 		if !ok {
 			log.Warnf("Skipping non-object record at index %d", i)
-			continue
+			return nil
 		}
 
-		if err := gp.processRecord(recordMap, nil, ""); err != nil {
-			log.Errorf("Failed to process record %d: %v", i, err)
+		gp.recordIndex = int64(i)
+		// Any error stops the run so that every writer is aborted: the rows already written
+		// from this record cannot be taken back, and a failed write or upload loses rows
+		if err := gp.processRecord(recordMap); err != nil {
+			return fmt.Errorf("record %d: %w", i, err)
 		}
+		return nil
 	}
 
-	log.Infof("Successfully parsed %d root records", len(records))
-	return nil
+	var count int
+	if format == formatNDJSON {
+		count, err = streamNDJSON(f, handle)
+	} else {
+		count, err = streamJSON(f, gp.config.Source.RootArray, handle)
+	}
+	if err != nil {
+		return count, err
+	}
+
+	log.Infof("Successfully parsed %d root records", count)
+	return count, nil
 }
 
-// processRecord recursively processes a record and its nested structures
-func (gp *GenericParser) processRecord(record map[string]interface{}, parentContext map[string]interface{}, currentPath string) error {
-	// Process each table configuration
-	for _, tableConfig := range gp.config.Tables {
-		if shouldProcessTable(tableConfig.JSONPath, currentPath) {
-			if err := gp.processTable(tableConfig, record, parentContext); err != nil {
+// processRecord evaluates the tables against a root record, in the tree's order: top level
+// tables against the record, child tables against each row their parent wrote
+func (gp *GenericParser) processRecord(record map[string]interface{}) error {
+	gp.resetRows()
+	gp.record = record
+
+	for _, tableConfig := range gp.tables.order {
+		if tableConfig.Parent == "" {
+			if err := gp.processTable(tableConfig, record, gp.rootContext(record), rootEntityKey); err != nil {
 				return err
 			}
+			continue
 		}
-	}
 
+		// Bind each parent row under the parent's name and alias
+		parent := gp.tables.byName[tableConfig.Parent]
+		for _, row := range gp.rows[parent.Name] {
+			ctx := contextWithEntity(row.ctx, parent, row.data)
+			if err := gp.processTable(tableConfig, row.data, ctx, gp.tables.keys[parent.Name]); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-// shouldProcessTable determines if a table should be processed at the current path
-func shouldProcessTable(tablePath, currentPath string) bool {
-	if tablePath == "" && currentPath == "" {
-		return true // Root level table
+// rootContext binds the root record to the root level tables that wrote it
+func (gp *GenericParser) rootContext(record map[string]interface{}) map[string]interface{} {
+	var ctx map[string]interface{}
+	for _, tableConfig := range gp.tables.entities[rootEntityKey] {
+		if gp.wrote(tableConfig, record) {
+			ctx = contextWithEntity(ctx, tableConfig, record)
+		}
 	}
-
-	// For nested paths, we'll handle them in processTable
-	return true
+	return ctx
 }
 
-// processTable processes a single table configuration
-func (gp *GenericParser) processTable(tableConfig models.TableConfig, record map[string]interface{}, parentContext map[string]interface{}) error {
+// processTable writes the rows a table's json_path selects in data, then processes the
+// table's children against each row. base is the entity key of data.
+func (gp *GenericParser) processTable(tableConfig models.TableConfig, data map[string]interface{}, parentContext map[string]interface{}, base string) error {
 	log.Debugf("Processing table: %s with json_path: %s", tableConfig.Name, tableConfig.JSONPath)
 
-	// Build parent context including current record
-	fullContext := cloneMap(parentContext)
-	fullContext["__current__"] = record
+	path := pathOf(tableConfig.JSONPath)
 
-	// Handle root level table (empty json_path)
-	if tableConfig.JSONPath == "" {
-		flatRecord := gp.createFlatRecord(tableConfig, record, fullContext)
-		writer := gp.getWriter(tableConfig.Name)
-		if err := writer.Write(flatRecord); err != nil {
-			return fmt.Errorf("failed to write record to %s: %w", tableConfig.Name, err)
-		}
-		return nil
+	// Handle root level table (empty json_path or "$"), or a child table reading its parent's rows
+	if path.IsRoot() {
+		return gp.processRow(tableConfig, data, parentContext, noOrdinal)
 	}
 
-	pathParts := strings.Split(tableConfig.JSONPath, ".")
-
-	// Recursive traversal that supports arrays at any level
-	var traverse func(data interface{}, idx int, ctx map[string]interface{}) error
-	traverse = func(data interface{}, idx int, ctx map[string]interface{}) error {
-		if idx >= len(pathParts) {
-			// We reached the target path; data should be an array of items to write
-			switch arr := data.(type) {
-			case []interface{}:
-				for _, item := range arr {
-					itemMap, ok := item.(map[string]interface{})
-					if !ok {
-						log.Warnf("Skipping non-object item at path %s", tableConfig.JSONPath)
-						continue
-					}
-					flatRecord := gp.createFlatRecord(tableConfig, itemMap, ctx)
-					writer := gp.getWriter(tableConfig.Name)
-					if err := writer.Write(flatRecord); err != nil {
-						return fmt.Errorf("failed to write record to %s: %w", tableConfig.Name, err)
-					}
-
-					// Prepare nested context with current entity bound under table name and its singular form
-					nextCtx := contextWithEntity(ctx, tableConfig.Name, itemMap)
-
-					if err := gp.processRecord(itemMap, nextCtx, tableConfig.JSONPath); err != nil {
-						return err
-					}
+	// Every match is a row, or an array of rows. Array elements entered on the way are
+	// bound in the context to the ancestor tables reading them. Paths such as $..items can
+	// reach an object more than once; it is still written once.
+	seen := make(map[uintptr]bool)
+	return path.Walk(data, func(value interface{}, trail []jsonpath.Trail) error {
+		ctx, indexes := gp.contextWithTrail(parentContext, base, path, trail, gp.positions[objectID(data)])
+
+		// Rows are the elements of a matched array, or a matched object which is itself an
+		// array element when the path selected it by index, wildcard or filter
+		var items []interface{}
+		ordinal := noOrdinal
+		switch v := value.(type) {
+		case []interface{}:
+			items = v
+		case map[string]interface{}:
+			items = []interface{}{v}
+			if n := len(trail); n > 0 {
+				if last, ok := trail[n-1].Value.(map[string]interface{}); ok && objectID(last) == objectID(v) {
+					ordinal = trail[n-1].Index
+					indexes = indexes[:len(indexes)-1]
 				}
-				return nil
-			default:
-				return fmt.Errorf("expected array at target path %s, got %T", tableConfig.JSONPath, data)
 			}
+		case nil:
+			return nil
+		default:
+			return fmt.Errorf("expected an array or object at path %s, got %T", tableConfig.JSONPath, value)
 		}
 
-		// If data is an array at this level, iterate and continue with same idx
-		switch cur := data.(type) {
-		case []interface{}:
-			for _, item := range cur {
-				// Carry forward context with the current array item as the entity under the PREVIOUS path part
-				// Because when we encounter an array, idx has already advanced past the part that yielded this array.
-				itemCtx := ctx
-				if m, ok := item.(map[string]interface{}); ok {
-					part := ""
-					if idx > 0 {
-						part = pathParts[idx-1]
-					}
-					if part != "" {
-						itemCtx = contextWithEntity(ctx, part, m)
-					}
-				}
-				if err := traverse(item, idx, itemCtx); err != nil {
-					return err
-				}
+		for i, item := range items {
+			itemMap, ok := item.(map[string]interface{})
+			if !ok {
+				log.Warnf("Skipping non-object item at path %s", tableConfig.JSONPath)
+				continue
 			}
-			return nil
-		case map[string]interface{}:
-			part := pathParts[idx]
-			if part == "" {
-				return traverse(cur, idx+1, ctx)
+			if id := objectID(itemMap); seen[id] {
+				continue
+			} else {
+				seen[id] = true
 			}
-			next, ok := cur[part]
-			if !ok || next == nil {
-				// Path doesn't exist in this branch; skip
-				return nil
+
+			rowOrdinal := ordinal
+			if _, isArray := value.([]interface{}); isArray {
+				rowOrdinal = i
 			}
-			return traverse(next, idx+1, ctx)
-		default:
-			// Unexpected type; nothing to do
+			rowIndexes := indexes
+			if rowOrdinal != noOrdinal {
+				rowIndexes = append(indexes[:len(indexes):len(indexes)], rowOrdinal)
+			}
+			gp.setPosition(itemMap, rowIndexes)
+
+			if err := gp.processRow(tableConfig, itemMap, ctx, rowOrdinal); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// processRow writes a row. ordinal is the row's position in its JSON array, or noOrdinal.
+// Rows not matching the table's where predicate are dropped, and so are never bound for the
+// tables below.
+func (gp *GenericParser) processRow(tableConfig models.TableConfig, row map[string]interface{}, parentContext map[string]interface{}, ordinal int) error {
+	if filter := gp.where[tableConfig.Name]; filter != nil {
+		match, err := filter.Test(expr.Env{Current: row, Root: gp.record, Vars: parentContext})
+		if err != nil {
+			return fmt.Errorf("table %s: where: %w", tableConfig.Name, err)
+		}
+		if !match {
+			gp.filtered[tableConfig.Name]++
 			return nil
 		}
 	}
+	return gp.writeRow(tableConfig, row, parentContext, ordinal)
+}
 
-	return traverse(record, 0, fullContext)
+// writeRow flattens a record and writes it to the table, applying the required_policy
+// when a required field is missing
+func (gp *GenericParser) writeRow(tableConfig models.TableConfig, record map[string]interface{}, parentContext map[string]interface{}, ordinal int) error {
+	flatRecord, err := gp.createFlatRecord(tableConfig, record, parentContext, ordinal)
+	if err != nil {
+		var reqErr *RequiredFieldError
+		var convErr *ConversionError
+		switch {
+		case errors.As(err, &reqErr):
+			if reqErr.Table == "" {
+				// missing sub-field of a struct column
+				reqErr.Table = tableConfig.Name
+			}
+		case errors.As(err, &convErr):
+			err = fmt.Errorf("table %s: %w", tableConfig.Name, err)
+		default:
+			return fmt.Errorf("table %s: %w", tableConfig.Name, err)
+		}
+		return gp.rejectRow(tableConfig, record, err)
+	}
+
+	if gp.rowSink != nil {
+		if err := gp.rowSink(tableConfig, flatRecord); err != nil {
+			return err
+		}
+	} else if err := gp.getWriter(tableConfig.Name).Write(flatRecord); err != nil {
+		return fmt.Errorf("failed to write record to %s: %w", tableConfig.Name, err)
+	}
+	gp.addRow(tableConfig, record, parentContext, flatRecord)
+	return nil
+}
+
+// rejectRow fails, skips or dead-letters a row with a missing required field or a value that
+// cannot be converted to its column type
+func (gp *GenericParser) rejectRow(tableConfig models.TableConfig, record map[string]interface{}, err error) error {
+	switch gp.requiredPolicies[tableConfig.Name] {
+	case policySkip:
+		log.Debugf("Skipping row: %v", err)
+		gp.skipped[tableConfig.Name]++
+		return nil
+	case policyDeadLetter:
+		return gp.deadLetter.Write(deadLetterEntry{
+			Table:       tableConfig.Name,
+			Error:       err.Error(),
+			SourceFile:  gp.sourceFile,
+			RecordIndex: gp.recordIndex,
+			Record:      record,
+		})
+	default:
+		return err
+	}
 }
 
 // createFlatRecord creates a flattened record from the configuration
-func (gp *GenericParser) createFlatRecord(tableConfig models.TableConfig, record map[string]interface{}, parentContext map[string]interface{}) models.GenericRecord {
+func (gp *GenericParser) createFlatRecord(tableConfig models.TableConfig, record map[string]interface{}, parentContext map[string]interface{}, ordinal int) (models.GenericRecord, error) {
 	flatRecord := make(models.GenericRecord)
 
 	// Add fields from parent entities
 	for _, parentRef := range tableConfig.ParentRefs {
-		var parentData map[string]interface{}
+		parentData, _ := parentContext[parentRef.EntityName].(map[string]interface{})
+		parent := gp.tables.byName[parentRef.EntityName]
 
-		if parentRef.EntityName == "user" {
-			if current, ok := parentContext["__current__"].(map[string]interface{}); ok {
-				parentData = current
+		if parentData == nil {
+			for _, field := range parentRef.Fields {
+				if field.Required {
+					return nil, &RequiredFieldError{Table: tableConfig.Name, Field: field.Name}
+				}
 			}
 		} else {
-			if data, ok := parentContext[parentRef.EntityName].(map[string]interface{}); ok {
-				parentData = data
-			}
-		}
-
-		if parentData != nil {
 			for _, field := range parentRef.Fields {
-				value := getValueFromPath(parentData, field.JSONPath)
-				flatRecord[field.Name] = convertValue(value, field.Type)
+				var value interface{}
+				switch {
+				case isParentKeyField(parent, &field):
+					key, err := gp.parentKey(parent, parentData)
+					if err != nil {
+						return nil, err
+					}
+					value = key
+				case field.Expr != "":
+					computed, err := gp.evalExpr(tableConfig, field, parentData, parentContext)
+					if err != nil {
+						return nil, err
+					}
+					value = computed
+				default:
+					value = fieldValue(parentData, field)
+				}
+				converted, err := convertField(value, field)
+				if err != nil {
+					return nil, &ConversionError{Err: err}
+				}
+				if converted == nil && field.Required {
+					return nil, &RequiredFieldError{Table: tableConfig.Name, Field: field.Name}
+				}
+				flatRecord[field.Name] = converted
 			}
 		}
 	}
 
 	// Add fields from current record
 	for _, field := range tableConfig.Fields {
-		value := getValueFromPath(record, field.JSONPath)
+		var value interface{}
+		switch {
+		case field.Name == tableConfig.CaptureUnmapped:
+			value = unmappedValues(record, gp.mappedKeys[tableConfig.Name])
+		case tableConfig.SurrogateKey != nil && field.Name == tableConfig.SurrogateKey.Name:
+			key, err := gp.newKey(tableConfig, record)
+			if err != nil {
+				return nil, err
+			}
+			value = key
+		case field.Name == tableConfig.OrdinalColumn:
+			if ordinal != noOrdinal {
+				value = int64(ordinal)
+			}
+		case field.Expr != "":
+			computed, err := gp.evalExpr(tableConfig, field, record, parentContext)
+			if err != nil {
+				return nil, err
+			}
+			value = computed
+		default:
+			value = fieldValue(record, field)
+		}
 
 		if value == nil && field.DefaultValue != "" {
 			value = field.DefaultValue
 		}
 
-		flatRecord[field.Name] = convertValue(value, field.Type)
+		converted, err := convertField(value, field)
+		if err != nil {
+			return nil, &ConversionError{Err: err}
+		}
+		if converted == nil && field.Required {
+			return nil, &RequiredFieldError{Table: tableConfig.Name, Field: field.Name}
+		}
+		flatRecord[field.Name] = converted
 	}
 
-	return flatRecord
-}
+	// Add provenance columns
+	for _, field := range tableConfig.Provenance {
+		switch field.Name {
+		case sourceFileColumn:
+			flatRecord[field.Name] = gp.sourceFile
+		case sourceRecordIndexColumn:
+			flatRecord[field.Name] = gp.recordIndex
+		}
+	}
 
-// getValueFromPath extracts value from a map using dot notation path
-func getValueFromPath(data map[string]interface{}, path string) interface{} {
-	parts := strings.Split(path, ".")
-	current := interface{}(data)
+	return flatRecord, nil
+}
 
-	for _, part := range parts {
-		dataMap, ok := current.(map[string]interface{})
-		if !ok {
-			return nil
-		}
-		current = dataMap[part]
-		if current == nil {
-			return nil
-		}
+// getValueFromPath extracts a value with a JSONPath expression (see internal/jsonpath);
+// paths that can match several values return them as a slice. With caseInsensitive, member
+// names also match keys differing only in case.
+func getValueFromPath(data map[string]interface{}, path string, caseInsensitive bool) interface{} {
+	if caseInsensitive {
+		return foldedPathOf(path).Value(data)
 	}
+	return pathOf(path).Value(data)
+}
 
-	return current
+// convertField converts a JSON value to the Go representation of the field's column type
+func convertField(value interface{}, field models.FieldConfig) (interface{}, error) {
+	if nestedKind(field.Type) != "" {
+		return convertNested(value, field)
+	}
+	if isTemporal(field) {
+		return convertTemporal(value, field)
+	}
+	if baseType(field.Type) == "decimal" {
+		return convertDecimal(value, field)
+	}
+	if isInteger(field) {
+		return convertInteger(value, field)
+	}
+	if field.Type == "json" {
+		return convertJSON(value, field)
+	}
+	return convertValue(value, field.Type), nil
 }
 
-// convertValue converts interface{} to the specified type
+// convertValue converts interface{} to the specified type.
+// Missing values and values that cannot be converted yield nil, which is written as null.
 func convertValue(value interface{}, targetType string) interface{} {
 	if value == nil {
-		switch targetType {
-		case "string":
-			return ""
-		case "int64":
-			return int64(0)
-		case "float64":
-			return float64(0)
-		case "bool":
-			return false
-		default:
-			return nil
-		}
+		return nil
 	}
 
 	switch targetType {
 	case "string":
 		return fmt.Sprintf("%v", value)
-	case "int64":
-		switch v := value.(type) {
-		case float64:
-			return int64(v)
-		case int:
-			return int64(v)
-		case int64:
-			return v
-		default:
-			return int64(0)
-		}
 	case "float64":
 		switch v := value.(type) {
 		case float64:
@@ -323,14 +606,26 @@ func convertValue(value interface{}, targetType string) interface{} {
 			return float64(v)
 		case int64:
 			return float64(v)
-		default:
-			return float64(0)
+		case json.Number:
+			if f, err := v.Float64(); err == nil {
+				return f
+			}
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return f
+			}
 		}
+		return nil
 	case "bool":
-		if b, ok := value.(bool); ok {
-			return b
+		switch v := value.(type) {
+		case bool:
+			return v
+		case string:
+			if b, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return b
+			}
 		}
-		return false
+		return nil
 	default:
 		return value
 	}
@@ -338,10 +633,31 @@ func convertValue(value interface{}, targetType string) interface{} {
 
 // initializeWriters creates writers for all configured tables
 func (gp *GenericParser) initializeWriters() error {
-	for _, tableConfig := range gp.config.Tables {
-		outputPath := filepath.Join(gp.config.OutputPath, fmt.Sprintf("%s.parquet", tableConfig.Name))
+	if gp.store == nil {
+		store, err := NewOutputStore(gp.config.OutputPath, gp.config.OutputS3)
+		if err != nil {
+			return err
+		}
+		gp.store = store
+	}
 
-		writer, err := NewDynamicWriter(outputPath, tableConfig, gp.config.Compression)
+	for _, policy := range gp.requiredPolicies {
+		if policy == policyDeadLetter && gp.deadLetter == nil {
+			gp.deadLetter = NewDeadLetterWriter(gp.store, gp.config.DeadLetterPath)
+		}
+	}
+
+	for _, tableConfig := range gp.config.Tables {
+		var (
+			writer tableWriter
+			err    error
+		)
+		options := resolveWriterOptions(gp.config, tableConfig)
+		if len(tableConfig.PartitionBy) > 0 {
+			writer, err = NewPartitionedWriter(gp.store, tableConfig, options)
+		} else {
+			writer, err = NewDynamicWriter(gp.store, tableConfig.Name, tableConfig, options)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to create writer for table %s: %w", tableConfig.Name, err)
 		}
@@ -354,24 +670,75 @@ func (gp *GenericParser) initializeWriters() error {
 }
 
 // getWriter retrieves a writer for a table
-func (gp *GenericParser) getWriter(tableName string) *DynamicWriter {
+func (gp *GenericParser) getWriter(tableName string) tableWriter {
 	gp.writersMux.RLock()
 	defer gp.writersMux.RUnlock()
 	return gp.writers[tableName]
 }
 
-// closeWriters closes all writers
-func (gp *GenericParser) closeWriters() {
+// closeWriters closes all writers and returns the first failure, e.g. an upload that could not
+// complete. Once one has failed, every writer is aborted, removing the files already completed.
+func (gp *GenericParser) closeWriters() error {
 	gp.writersMux.Lock()
 	defer gp.writersMux.Unlock()
 
+	var firstErr error
 	for name, writer := range gp.writers {
 		if err := writer.Close(); err != nil {
 			log.Errorf("Failed to close writer for table %s: %v", name, err)
-		} else {
-			log.Infof("Closed writer for table: %s", name)
+			firstErr = fmt.Errorf("failed to close writer for table %s: %w", name, err)
+			break
 		}
+		log.Infof("Closed writer for table: %s", name)
 	}
+	if firstErr != nil {
+		// Complete no further files or uploads, and take back the ones completed
+		for name, writer := range gp.writers {
+			if err := writer.Abort(); err != nil {
+				log.Errorf("Failed to abort writer for table %s: %v", name, err)
+			}
+		}
+	}
+	if err := gp.closeDeadLetter(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// OutputFiles returns the files produced for each table, available once parsing has finished
+func (gp *GenericParser) OutputFiles() map[string][]string {
+	gp.writersMux.RLock()
+	defer gp.writersMux.RUnlock()
+
+	files := make(map[string][]string, len(gp.writers))
+	for name, writer := range gp.writers {
+		files[name] = writer.Files()
+	}
+	return files
+}
+
+// abortWriters discards the output of all writers after a failure
+func (gp *GenericParser) abortWriters() {
+	gp.writersMux.Lock()
+	defer gp.writersMux.Unlock()
+
+	for name, writer := range gp.writers {
+		if err := writer.Abort(); err != nil {
+			log.Errorf("Failed to abort writer for table %s: %v", name, err)
+		}
+	}
+	// Rejected rows are kept, they help diagnosing the failure
+	if err := gp.closeDeadLetter(); err != nil {
+		log.Errorf("%v", err)
+	}
+}
+
+// closeDeadLetter finalizes the dead-letter file, if one is in use
+func (gp *GenericParser) closeDeadLetter() error {
+	if gp.deadLetter == nil {
+		return nil
+	}
+	return gp.deadLetter.Close()
 }
 
 // ParseGeneric is the main entry point for generic parsing
@@ -381,8 +748,16 @@ func ParseGeneric(configPath string) error {
 		return err
 	}
 
-	// Backward-compat: parse directly from configured source path (no downloading here)
-	return parser.ParseFile(parser.config.Source.Path)
+	// Backward-compat: parse directly from configured source paths (no downloading here)
+	paths, err := ExpandSourcePaths(parser.config.Source.Path)
+	if err != nil {
+		return err
+	}
+	inputs := make([]InputFile, 0, len(paths))
+	for _, p := range paths {
+		inputs = append(inputs, InputFile{LocalPath: p, Origin: p})
+	}
+	return parser.ParseFiles(inputs)
 }
 
 // ---- internal helpers for context management ----
@@ -397,23 +772,3 @@ func cloneMap(src map[string]interface{}) map[string]interface{} {
 	}
 	return dst
 }
-
-// singularize returns a naive singular form by trimming a trailing 's'.
-func singularize(name string) string {
-	if strings.HasSuffix(name, "s") && len(name) > 1 {
-		return name[:len(name)-1]
-	}
-	return name
-}
-
-// contextWithEntity returns a cloned context with the entity bound under both
-// the provided plural name and its naive singular form.
-func contextWithEntity(ctx map[string]interface{}, pluralName string, entity map[string]interface{}) map[string]interface{} {
-	next := cloneMap(ctx)
-	next[pluralName] = entity
-	sg := singularize(pluralName)
-	if sg != pluralName {
-		next[sg] = entity
-	}
-	return next
-}
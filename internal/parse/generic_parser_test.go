@@ -0,0 +1,61 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// newTestParser builds a parser from the settings below source and output_path. The rows are
+// collected by table instead of being written.
+func newTestParser(t *testing.T, config string) (*GenericParser, map[string][]models.GenericRecord) {
+	t.Helper()
+	data := "source: {type: file, path: in.json}\noutput_path: out\n" + config
+	parsed, diagnostics := decodeParseConfig("config.yaml", []byte(data))
+	if HasErrors(diagnostics) {
+		t.Fatalf("config: %v", &ConfigError{Diagnostics: diagnostics})
+	}
+	gp, err := newGenericParser(parsed)
+	if err != nil {
+		t.Fatalf("newGenericParser: %v", err)
+	}
+
+	rows := make(map[string][]models.GenericRecord)
+	gp.rowSink = func(tableConfig models.TableConfig, record models.GenericRecord) error {
+		rows[tableConfig.Name] = append(rows[tableConfig.Name], record)
+		return nil
+	}
+	return gp, rows
+}
+
+// decodeRecord decodes a root record like the parser does, with numbers kept as json.Number
+func decodeRecord(t *testing.T, doc string) map[string]interface{} {
+	t.Helper()
+	dec := json.NewDecoder(strings.NewReader(doc))
+	dec.UseNumber()
+	var record map[string]interface{}
+	if err := dec.Decode(&record); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// renderRows writes the given columns of each row as space separated values, null for nil
+func renderRows(rows []models.GenericRecord, columns ...string) []string {
+	rendered := make([]string, len(rows))
+	for i, row := range rows {
+		values := make([]string, len(columns))
+		for j, column := range columns {
+			if v := row[column]; v != nil {
+				values[j] = fmt.Sprint(v)
+			} else {
+				values[j] = "null"
+			}
+		}
+		rendered[i] = strings.Join(values, " ")
+	}
+	return rendered
+}
@@ -0,0 +1,441 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// InferOptions controls schema inference from a sample file
+type InferOptions struct {
+	Source    models.SourceConfig // root_array, format and compression of the sample
+	Limit     int                 // Root records to scan, 0 for the whole file
+	TableName string              // Name of the root table, defaults to the file name
+	Examples  int                 // Example values kept per column, defaults to 3
+}
+
+// maxInferredObjectKeys is the number of distinct keys above which an object is taken for a
+// map keyed by data and kept as a json column instead of being flattened into columns
+const maxInferredObjectKeys = 64
+
+// maxTrackedIDValues caps the values remembered to check ID candidates for uniqueness
+const maxTrackedIDValues = 1 << 20
+
+// shapeStats accumulates what was seen at one location of the sample
+type shapeStats struct {
+	present int // values seen, including null
+	nulls   int
+
+	bools, ints, floats, strings, objects, arrays int
+
+	minInt, maxInt *big.Int // range of integral numbers
+	timestamps     int      // strings parsing as RFC 3339 timestamps
+	dates          int      // strings parsing as YYYY-MM-DD dates
+
+	examples    []string
+	maxExamples int
+
+	// ID candidates remember their values to check uniqueness
+	values     map[string]bool
+	duplicates bool
+
+	fields   map[string]*shapeStats
+	elements *shapeStats
+}
+
+func newShapeStats(maxExamples int, trackValues bool) *shapeStats {
+	s := &shapeStats{maxExamples: maxExamples}
+	if trackValues {
+		s.values = make(map[string]bool)
+	}
+	return s
+}
+
+// observe records one value at this location
+func (s *shapeStats) observe(v interface{}) {
+	s.present++
+	switch x := v.(type) {
+	case nil:
+		s.nulls++
+	case bool:
+		s.bools++
+		s.example(strconv.FormatBool(x))
+	case json.Number:
+		if n, ok := new(big.Int).SetString(x.String(), 10); ok {
+			s.ints++
+			if s.minInt == nil || n.Cmp(s.minInt) < 0 {
+				s.minInt = n
+			}
+			if s.maxInt == nil || n.Cmp(s.maxInt) > 0 {
+				s.maxInt = n
+			}
+		} else {
+			s.floats++
+		}
+		s.example(x.String())
+		s.track(x.String())
+	case string:
+		s.strings++
+		if _, err := time.Parse(time.RFC3339Nano, x); err == nil {
+			s.timestamps++
+		} else if _, err := time.Parse("2006-01-02", x); err == nil {
+			s.dates++
+		}
+		s.example(strconv.Quote(truncate(x, 40)))
+		s.track(x)
+	case map[string]interface{}:
+		s.objects++
+		if s.fields == nil {
+			s.fields = make(map[string]*shapeStats)
+		}
+		for key, value := range x {
+			field, ok := s.fields[key]
+			if !ok {
+				field = newShapeStats(s.maxExamples, isIDName(key))
+				s.fields[key] = field
+			}
+			field.observe(value)
+		}
+	case []interface{}:
+		s.arrays++
+		if s.elements == nil {
+			s.elements = newShapeStats(s.maxExamples, false)
+		}
+		for _, item := range x {
+			s.elements.observe(item)
+		}
+	}
+}
+
+// example keeps the first distinct values seen
+func (s *shapeStats) example(v string) {
+	if len(s.examples) >= s.maxExamples {
+		return
+	}
+	for _, e := range s.examples {
+		if e == v {
+			return
+		}
+	}
+	s.examples = append(s.examples, v)
+}
+
+// track remembers the values of ID candidates
+func (s *shapeStats) track(v string) {
+	if s.values == nil || s.duplicates {
+		return
+	}
+	if s.values[v] {
+		s.duplicates = true
+		return
+	}
+	if len(s.values) < maxTrackedIDValues {
+		s.values[v] = true
+	}
+}
+
+// nonNull is the number of non-null values seen
+func (s *shapeStats) nonNull() int {
+	return s.present - s.nulls
+}
+
+// isObject reports whether every non-null value was an object with a manageable set of keys
+func (s *shapeStats) isObject() bool {
+	return s.objects > 0 && s.objects == s.nonNull() && len(s.fields) <= maxInferredObjectKeys
+}
+
+// isObjectArray reports whether every non-null value was an array of objects
+func (s *shapeStats) isObjectArray() bool {
+	return s.arrays > 0 && s.arrays == s.nonNull() && s.elements.isObject()
+}
+
+// inferType returns the column type for the values seen, widening numbers to float64 and
+// mixed scalars to string; mixes involving objects or arrays become json
+func (s *shapeStats) inferType() string {
+	numbers := s.ints + s.floats
+	kinds := 0
+	for _, n := range []int{s.bools, numbers, s.strings, s.objects, s.arrays} {
+		if n > 0 {
+			kinds++
+		}
+	}
+
+	switch {
+	case kinds == 0:
+		return "string"
+	case kinds > 1:
+		if s.objects > 0 || s.arrays > 0 {
+			return "json"
+		}
+		return "string"
+	case s.bools > 0:
+		return "bool"
+	case numbers > 0:
+		return s.numberType()
+	case s.strings > 0:
+		switch s.strings {
+		case s.timestamps:
+			return "timestamp"
+		case s.dates:
+			return "date"
+		}
+		return "string"
+	case s.arrays > 0:
+		if s.elements.arrays > 0 || s.elements.objects > 0 {
+			return "json"
+		}
+		if s.elements.nonNull() == 0 {
+			return "list<string>"
+		}
+		if elem := s.elements.inferType(); elem != "json" {
+			return "list<" + elem + ">"
+		}
+		return "json"
+	}
+	return "json"
+}
+
+// numberType picks int64, uint64 or decimal(38,0) for integers by range, float64 otherwise
+func (s *shapeStats) numberType() string {
+	if s.floats > 0 {
+		return "float64"
+	}
+	switch {
+	case s.minInt.IsInt64() && s.maxInt.IsInt64():
+		return "int64"
+	case s.minInt.Sign() >= 0 && s.maxInt.IsUint64():
+		return "uint64"
+	case s.minInt.CmpAbs(pow10(maxDecimalPrecision)) < 0 && s.maxInt.CmpAbs(pow10(maxDecimalPrecision)) < 0:
+		return "decimal(38,0)"
+	}
+	return "float64"
+}
+
+// isIDName reports whether a key looks like an identifier: id, _id, user_id, userId
+func isIDName(key string) bool {
+	lower := strings.ToLower(key)
+	return lower == "id" || lower == "_id" || strings.HasSuffix(lower, "_id") || strings.HasSuffix(key, "Id") || strings.HasSuffix(key, "ID")
+}
+
+// truncate shortens long example strings
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// inferredTable is a table derived from an array-of-objects location
+type inferredTable struct {
+	name       string
+	parent     *inferredTable
+	jsonPath   string // relative to the parent's rows, "" for the root records
+	rows       int
+	fields     []inferredField
+	id         *inferredField
+	parentRefs []inferredParentRef
+}
+
+// inferredField is a column of an inferred table
+type inferredField struct {
+	name     string
+	jsonPath string
+	typ      string
+	required bool
+	comment  string
+}
+
+// inferredParentRef copies an ancestor's ID into a child table
+type inferredParentRef struct {
+	table *inferredTable
+	field inferredField
+}
+
+// tableInference builds the tables from the statistics of the root records
+type tableInference struct {
+	tables []*inferredTable
+	names  map[string]bool
+}
+
+// addTable builds the table reading the objects described by stats, then its child tables
+func (ti *tableInference) addTable(name string, parent *inferredTable, jsonPath string, stats *shapeStats) {
+	t := &inferredTable{name: ti.uniqueName(name, parent), parent: parent, jsonPath: jsonPath, rows: stats.objects}
+	ti.tables = append(ti.tables, t)
+
+	type child struct {
+		key   string
+		path  string
+		stats *shapeStats
+	}
+	var children []child
+	var idCandidates []inferredField
+
+	var collect func(stats *shapeStats, pathPrefix, namePrefix string)
+	collect = func(stats *shapeStats, pathPrefix, namePrefix string) {
+		for _, key := range slices.Sorted(maps.Keys(stats.fields)) {
+			fs := stats.fields[key]
+			path := joinInferredPath(pathPrefix, key)
+			name := namePrefix + columnName(key)
+			switch {
+			case fs.isObjectArray():
+				children = append(children, child{key: key, path: path, stats: fs.elements})
+			case fs.isObject():
+				collect(fs, path, name+"_")
+			default:
+				t.fields = append(t.fields, inferredField{
+					name:     name,
+					jsonPath: path,
+					typ:      fs.inferType(),
+					required: t.rows > 0 && fs.nonNull() == t.rows,
+					comment:  fieldComment(fs, t.rows),
+				})
+				// IDs are unique, always set top level scalars
+				if pathPrefix == "" && fs.values != nil && !fs.duplicates && fs.nonNull() == t.rows && t.rows > 0 {
+					idCandidates = append(idCandidates, t.fields[len(t.fields)-1])
+				}
+			}
+		}
+	}
+	collect(stats, "", "")
+
+	// Prefer a field named id over user_id style references to other entities
+	for i := range idCandidates {
+		if t.id == nil || strings.EqualFold(strings.TrimPrefix(idCandidates[i].jsonPath, "_"), "id") {
+			t.id = &idCandidates[i]
+		}
+	}
+
+	t.parentRefs = inferParentRefs(t)
+
+	for _, c := range children {
+		ti.addTable(columnName(c.key), t, c.path, c.stats)
+	}
+}
+
+// uniqueName returns name, prefixed by the parent's name when it is already taken
+func (ti *tableInference) uniqueName(name string, parent *inferredTable) string {
+	if ti.names[name] && parent != nil {
+		name = parent.name + "_" + name
+	}
+	base := name
+	for i := 2; ti.names[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+	ti.names[name] = true
+	return name
+}
+
+// inferParentRefs references the ID of every ancestor that has one. The column keeps the ID
+// field's name when it already names its entity (user_id) and is prefixed with the ancestor's
+// table name otherwise, or when it clashes with a column of the table.
+func inferParentRefs(t *inferredTable) []inferredParentRef {
+	taken := make(map[string]bool)
+	for _, f := range t.fields {
+		taken[f.name] = true
+	}
+
+	var refs []inferredParentRef
+	for ancestor := t.parent; ancestor != nil; ancestor = ancestor.parent {
+		if ancestor.id == nil {
+			continue
+		}
+		name := ancestor.id.name
+		if strings.EqualFold(name, "id") || strings.EqualFold(name, "_id") || taken[name] {
+			name = ancestor.name + "_" + strings.TrimPrefix(name, "_")
+		}
+		taken[name] = true
+		refs = append(refs, inferredParentRef{table: ancestor, field: inferredField{
+			name:     name,
+			jsonPath: ancestor.id.jsonPath,
+			typ:      ancestor.id.typ,
+			required: true,
+		}})
+	}
+	return refs
+}
+
+// fieldComment summarises how often a field was set and a few of its values
+func fieldComment(s *shapeStats, rows int) string {
+	comment := fmt.Sprintf("%d/%d non-null", s.nonNull(), rows)
+	if len(s.examples) > 0 {
+		comment += ", e.g. " + strings.Join(s.examples, ", ")
+	}
+	return comment
+}
+
+// plainKey matches keys that need no quoting in a JSONPath
+var plainKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// joinInferredPath appends a key to a relative JSONPath, quoting keys with special characters
+func joinInferredPath(prefix, key string) string {
+	if !plainKey.MatchString(key) {
+		return prefix + "['" + strings.ReplaceAll(key, "'", `\'`) + "']"
+	}
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// nonIdentifier matches the characters not allowed in column names
+var nonIdentifier = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// columnName turns a JSON key into a column name of letters, digits and underscores
+func columnName(key string) string {
+	name := strings.Trim(nonIdentifier.ReplaceAllString(key, "_"), "_")
+	if name == "" {
+		name = "field"
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		name = "_" + name
+	}
+	return name
+}
+
+// InferConfig scans a sample file and returns a parse config YAML with one table per
+// array-of-objects location, annotated with row counts and example values
+func InferConfig(path string, opts InferOptions) ([]byte, error) {
+	if opts.Examples <= 0 {
+		opts.Examples = 3
+	}
+
+	root := newShapeStats(opts.Examples, false)
+	nonObjects := 0
+	count, err := StreamFile(path, opts.Source, opts.Limit, func(_ int, record interface{}) error {
+		if _, ok := record.(map[string]interface{}); !ok {
+			nonObjects++
+			return nil
+		}
+		root.observe(record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if root.objects == 0 {
+		return nil, fmt.Errorf("no JSON object records found in %s", path)
+	}
+	if nonObjects > 0 {
+		log.Warnf("Ignored %d root records that are not objects", nonObjects)
+	}
+
+	name := opts.TableName
+	if name == "" {
+		base := filepath.Base(trimCompressionExt(path))
+		name = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+
+	ti := &tableInference{names: make(map[string]bool)}
+	ti.addTable(columnName(name), nil, "", root)
+
+	return renderInferredConfig(path, opts, count, ti.tables)
+}
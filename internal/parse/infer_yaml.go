@@ -0,0 +1,129 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// renderInferredConfig writes the inferred tables as a parse config YAML. Nodes are built by
+// hand so that only the relevant keys appear and counts and examples become comments.
+func renderInferredConfig(path string, opts InferOptions, records int, tables []*inferredTable) ([]byte, error) {
+	source := mappingNode(
+		"type", quotedNode("file"),
+		"path", quotedNode(path),
+	)
+	if opts.Source.RootArray != "" {
+		source.Content = append(source.Content, scalarNode("root_array"), quotedNode(opts.Source.RootArray))
+	}
+	if opts.Source.Format != "" {
+		source.Content = append(source.Content, scalarNode("format"), quotedNode(opts.Source.Format))
+	}
+	if opts.Source.Compression != "" {
+		source.Content = append(source.Content, scalarNode("compression"), quotedNode(opts.Source.Compression))
+	}
+
+	tableNodes := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, t := range tables {
+		tableNodes.Content = append(tableNodes.Content, tableNode(t))
+	}
+
+	doc := mappingNode(
+		"source", source,
+		"output_path", quotedNode("output"),
+		"compression", quotedNode("zstd"),
+		"tables", tableNodes,
+	)
+	scanned := fmt.Sprintf("%d root records", records)
+	if opts.Limit > 0 {
+		scanned = fmt.Sprintf("the first %d root records", records)
+	}
+	doc.HeadComment = fmt.Sprintf("Inferred by json2parquet infer from %s (%s).\n"+
+		"Types, required flags and parent_refs reflect the sample only; review before use.", path, scanned)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{doc}}); err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// tableNode renders one table with its fields and parent_refs
+func tableNode(t *inferredTable) *yaml.Node {
+	node := mappingNode("name", quotedNode(t.name))
+	if t.parent != nil {
+		node.Content = append(node.Content, scalarNode("parent"), quotedNode(t.parent.name))
+	}
+	node.Content = append(node.Content, scalarNode("json_path"), quotedNode(t.jsonPath))
+
+	node.HeadComment = fmt.Sprintf("%d row", t.rows)
+	if t.rows != 1 {
+		node.HeadComment += "s"
+	}
+	if t.parent != nil {
+		node.HeadComment += " under " + t.parent.name
+	}
+	if t.id != nil {
+		node.HeadComment += fmt.Sprintf(", identified by %s", t.id.jsonPath)
+	}
+
+	fields := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, f := range t.fields {
+		fields.Content = append(fields.Content, fieldNode(f))
+	}
+	if len(fields.Content) == 0 {
+		fields.Style = yaml.FlowStyle
+	}
+	node.Content = append(node.Content, scalarNode("fields"), fields)
+
+	if len(t.parentRefs) > 0 {
+		refs := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, ref := range t.parentRefs {
+			refs.Content = append(refs.Content, mappingNode(
+				"entity_name", quotedNode(ref.table.name),
+				"fields", &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{fieldNode(ref.field)}},
+			))
+		}
+		node.Content = append(node.Content, scalarNode("parent_refs"), refs)
+	}
+	return node
+}
+
+// fieldNode renders a field as a flow mapping with its statistics as a line comment
+func fieldNode(f inferredField) *yaml.Node {
+	node := mappingNode(
+		"name", quotedNode(f.name),
+		"json_path", quotedNode(f.jsonPath),
+		"type", quotedNode(f.typ),
+	)
+	if f.required {
+		node.Content = append(node.Content, scalarNode("required"), scalarNode(strconv.FormatBool(true)))
+	}
+	node.Style = yaml.FlowStyle
+	node.LineComment = f.comment
+	return node
+}
+
+// mappingNode builds a mapping from alternating keys and value nodes
+func mappingNode(pairs ...interface{}) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i < len(pairs); i += 2 {
+		node.Content = append(node.Content, scalarNode(pairs[i].(string)), pairs[i+1].(*yaml.Node))
+	}
+	return node
+}
+
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+func quotedNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: yaml.DoubleQuotedStyle}
+}
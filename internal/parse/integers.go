@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// integerRange describes the values an integer column type can hold
+type integerRange struct {
+	bits     int
+	unsigned bool
+}
+
+// integerTypes are the supported integer column types
+var integerTypes = map[string]integerRange{
+	"int64":  {bits: 64},
+	"int32":  {bits: 32},
+	"int16":  {bits: 16},
+	"int8":   {bits: 8},
+	"uint64": {bits: 64, unsigned: true},
+}
+
+// isInteger reports whether the field is one of the integer column types
+func isInteger(field models.FieldConfig) bool {
+	_, ok := integerTypes[field.Type]
+	return ok
+}
+
+// convertInteger converts a JSON number (or numeric string) to int64, or uint64 for unsigned columns.
+// Numbers are read from their JSON text so values above 2^53 keep every digit. Fractional values and
+// values outside the column range are errors rather than being truncated or wrapped; values that are
+// not numbers yield nil.
+func convertInteger(value interface{}, field models.FieldConfig) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		text = v.String()
+	case string:
+		text = strings.TrimSpace(v)
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case int64:
+		text = strconv.FormatInt(v, 10)
+	case int:
+		text = strconv.Itoa(v)
+	case uint64:
+		text = strconv.FormatUint(v, 10)
+	default:
+		log.Debugf("field %s: expected an integer, got %T", field.Name, value)
+		return nil, nil
+	}
+
+	n, ok := new(big.Int).SetString(text, 10)
+	if !ok {
+		// Exponent or fraction notation, e.g. 1e3 or 42.0, is fine as long as the value is whole
+		rat, ok := new(big.Rat).SetString(text)
+		if !ok {
+			log.Debugf("field %s: invalid integer value %q", field.Name, text)
+			return nil, nil
+		}
+		if !rat.IsInt() {
+			return nil, fmt.Errorf("field %s: value %s is not an integer", field.Name, text)
+		}
+		n = rat.Num()
+	}
+
+	r := integerTypes[field.Type]
+	if r.unsigned {
+		if n.Sign() < 0 || n.BitLen() > r.bits {
+			return nil, fmt.Errorf("field %s: value %s out of range for %s", field.Name, text, field.Type)
+		}
+		return n.Uint64(), nil
+	}
+
+	if !n.IsInt64() {
+		return nil, fmt.Errorf("field %s: value %s out of range for %s", field.Name, text, field.Type)
+	}
+	i := n.Int64()
+	min, max := int64(math.MinInt64)>>(64-r.bits), int64(math.MaxInt64)>>(64-r.bits)
+	if i < min || i > max {
+		return nil, fmt.Errorf("field %s: value %s out of range for %s", field.Name, text, field.Type)
+	}
+	return i, nil
+}
@@ -0,0 +1,106 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/internal/expr"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// convertJSON serializes any JSON value back to compact JSON text for a json column.
+// Numbers keep their original text since records are decoded with json.Number.
+func convertJSON(value interface{}, field models.FieldConfig) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: failed to encode JSON: %w", field.Name, err)
+	}
+	return string(data), nil
+}
+
+// injectUnmapped adds the capture_unmapped column of each table that sets one
+func injectUnmapped(config *models.ParseConfig) error {
+	for i, tableConfig := range config.Tables {
+		if tableConfig.CaptureUnmapped == "" {
+			continue
+		}
+		for _, field := range getAllFields(tableConfig) {
+			if field.Name == tableConfig.CaptureUnmapped {
+				return fmt.Errorf("table %s: capture_unmapped column %s clashes with a field of the same name", tableConfig.Name, field.Name)
+			}
+		}
+		config.Tables[i].Fields = append(config.Tables[i].Fields, models.FieldConfig{Name: tableConfig.CaptureUnmapped, Type: "json"})
+	}
+	return nil
+}
+
+// keySet holds the keys of a table's objects read by its fields; folded keys are matched
+// ignoring case, for fields with case_insensitive
+type keySet struct {
+	exact  map[string]bool
+	folded map[string]bool
+}
+
+// has reports whether the set covers key
+func (s keySet) has(key string) bool {
+	return s.exact[key] || s.folded[strings.ToLower(key)]
+}
+
+// mappedKeys returns the keys of a table's objects that are read by its fields or lead to a child table
+func mappedKeys(tableConfig models.TableConfig, entityKeys map[string]string, exprs map[string]*expr.Expr) keySet {
+	keys := keySet{exact: make(map[string]bool), folded: make(map[string]bool)}
+	for _, field := range tableConfig.Fields {
+		if field.Expr != "" {
+			for _, key := range exprs[field.Name].Keys() {
+				keys.exact[key] = true
+			}
+			continue
+		}
+		if field.Name == tableConfig.CaptureUnmapped || !hasSource(field) {
+			continue
+		}
+		for _, path := range fieldPaths(field) {
+			key, ok := pathOf(path).FirstKey()
+			switch {
+			case !ok:
+			case field.CaseInsensitive:
+				keys.folded[strings.ToLower(key)] = true
+			default:
+				keys.exact[key] = true
+			}
+		}
+	}
+
+	// Descendant tables read the member leading to them
+	own := entityKeys[tableConfig.Name]
+	for _, key := range entityKeys {
+		if !isAncestorKey(own, key) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, own)
+		if name, ok := pathOf(rootEntityKey + rest).FirstKey(); ok {
+			keys.exact[name] = true
+		}
+	}
+	return keys
+}
+
+// unmappedValues collects the keys of record not covered by mapped. It returns an untyped nil
+// when every key is mapped, which is written as null rather than as the JSON text "null".
+func unmappedValues(record map[string]interface{}, mapped keySet) interface{} {
+	unmapped := make(map[string]interface{})
+	for key, value := range record {
+		if !mapped.has(key) {
+			unmapped[key] = value
+		}
+	}
+	if len(unmapped) == 0 {
+		return nil
+	}
+	return unmapped
+}
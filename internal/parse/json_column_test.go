@@ -0,0 +1,32 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+func TestCaptureUnmapped(t *testing.T) {
+	mapped := keySet{exact: map[string]bool{"id": true}, folded: map[string]bool{"name": true}}
+	field := models.FieldConfig{Name: "extra", Type: "json"}
+	tests := []struct {
+		name   string
+		record map[string]interface{}
+		want   interface{}
+	}{
+		{name: "all mapped", record: map[string]interface{}{"id": 1, "NAME": "a"}, want: nil},
+		{name: "empty", record: map[string]interface{}{}, want: nil},
+		{name: "unmapped", record: map[string]interface{}{"id": 1, "b": true, "a": nil}, want: `{"a":null,"b":true}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := convertField(unmappedValues(tt.record, mapped), field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package parse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// recordFunc receives each decoded root record together with its position in the source
+type recordFunc func(index int, record interface{}) error
+
+// errStopStream ends a stream early; StreamFile does not report it
+var errStopStream = errors.New("stop reading records")
+
+// StreamFile reads the root records of a local file, detecting its format and compression from
+// the source config and the file extension like the generic parser. When limit is positive it
+// stops after that many records. It returns the number of records handed to fn.
+func StreamFile(path string, source models.SourceConfig, limit int, fn func(index int, record interface{}) error) (int, error) {
+	return streamInput(InputFile{LocalPath: path, Origin: path}, source, limit, fn)
+}
+
+// streamInput reads up to limit root records (all when limit is not positive) of a downloaded input
+func streamInput(input InputFile, source models.SourceConfig, limit int, fn recordFunc) (int, error) {
+	format, err := resolveFormat(source, input.LocalPath)
+	if err != nil {
+		return 0, err
+	}
+	codec, err := resolveCompression(source.Compression, input.ContentEncoding, input.LocalPath)
+	if err != nil {
+		return 0, err
+	}
+	f, err := openInput(input.LocalPath, codec)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	read := 0
+	handle := func(i int, record interface{}) error {
+		if limit > 0 && read >= limit {
+			return errStopStream
+		}
+		read++
+		return fn(i, record)
+	}
+
+	if format == formatNDJSON {
+		_, err = streamNDJSON(f, handle)
+	} else {
+		_, err = streamJSON(f, source.RootArray, handle)
+	}
+	if errors.Is(err, errStopStream) {
+		err = nil
+	}
+	return read, err
+}
+
+// streamJSON decodes root records from r one at a time and hands each to fn.
+// Supported layouts:
+// - a root array: every element is a root record
+// - a root object with rootArray empty: the object itself is the single root record
+// - a root object with rootArray set: elements of the array at that (dot-separated) key path
+// Only one root record is held in memory at a time. It returns the number of records decoded.
+func streamJSON(r io.Reader, rootArray string, fn recordFunc) (int, error) {
+	br := bufio.NewReaderSize(r, 1024*1024)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read JSON: %w", err)
+	}
+
+	dec := json.NewDecoder(br)
+	// Keep numbers as their JSON text so decimals and large integers are not rounded through float64
+	dec.UseNumber()
+
+	switch {
+	case first == '[':
+		if _, err := dec.Token(); err != nil {
+			return 0, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		return streamArray(dec, fn)
+	case first == '{' && rootArray == "":
+		var record interface{}
+		if err := dec.Decode(&record); err != nil {
+			return 0, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		return 1, fn(0, record)
+	case first == '{':
+		if _, err := dec.Token(); err != nil {
+			return 0, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		if err := seekRootArray(dec, rootArray, strings.Split(rootArray, ".")); err != nil {
+			return 0, err
+		}
+		return streamArray(dec, fn)
+	default:
+		return 0, fmt.Errorf("unsupported JSON structure")
+	}
+}
+
+// streamArray decodes the elements of an array whose opening bracket was already consumed
+func streamArray(dec *json.Decoder, fn recordFunc) (int, error) {
+	count := 0
+	for dec.More() {
+		var record interface{}
+		if err := dec.Decode(&record); err != nil {
+			return count, fmt.Errorf("failed to parse JSON at record %d: %w", count, err)
+		}
+		if err := fn(count, record); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	// Consume the closing bracket
+	if _, err := dec.Token(); err != nil {
+		return count, fmt.Errorf("failed to parse JSON after record %d: %w", count, err)
+	}
+
+	return count, nil
+}
+
+// seekRootArray advances the decoder, positioned inside an object, to the first element
+// of the array found under the given key path. Sibling values are skipped token by token.
+func seekRootArray(dec *json.Decoder, rootArray string, parts []string) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		key, _ := tok.(string)
+
+		if key != parts[0] {
+			if err := skipValue(dec); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tok, err = dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		delim, _ := tok.(json.Delim)
+
+		if len(parts) == 1 {
+			if delim != '[' {
+				return fmt.Errorf("root_array '%s' is not an array", rootArray)
+			}
+			return nil
+		}
+		if delim != '{' {
+			return fmt.Errorf("root_array '%s' not found: '%s' is not an object", rootArray, key)
+		}
+		return seekRootArray(dec, rootArray, parts[1:])
+	}
+
+	return fmt.Errorf("root_array '%s' not found", rootArray)
+}
+
+// skipValue consumes the next value from the decoder without materializing it
+func skipValue(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		switch tok {
+		case json.Delim('['), json.Delim('{'):
+			depth++
+		case json.Delim(']'), json.Delim('}'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// peekNonSpace returns the first non-whitespace byte without consuming it
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, fmt.Errorf("empty JSON document")
+			}
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, br.UnreadByte()
+	}
+}
+
+// streamNDJSON decodes newline-delimited JSON, treating every non-blank line as a root record.
+// Malformed lines are reported with their line number and skipped instead of aborting the file.
+// It returns the number of records decoded.
+func streamNDJSON(r io.Reader, fn recordFunc) (int, error) {
+	br := bufio.NewReaderSize(r, 1024*1024)
+	count, malformed, lineNo := 0, 0, 0
+
+	for {
+		line, readErr := br.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return count, fmt.Errorf("failed to read line %d: %w", lineNo+1, readErr)
+		}
+		if len(line) > 0 {
+			lineNo++
+		}
+
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var record interface{}
+			if err := decodeNumbers(trimmed, &record); err != nil {
+				malformed++
+				log.Warnf("Skipping malformed JSON at line %d: %v", lineNo, err)
+			} else {
+				if err := fn(count, record); err != nil {
+					return count, err
+				}
+				count++
+			}
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+	}
+
+	if malformed > 0 {
+		log.Warnf("Skipped %d malformed line(s) out of %d", malformed, lineNo)
+	}
+
+	return count, nil
+}
+
+// Source formats understood by the parser
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// resolveFormat returns the configured source format, falling back to the file extension
+func resolveFormat(source models.SourceConfig, path string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(source.Format)) {
+	case "json":
+		return formatJSON, nil
+	case "ndjson", "jsonl", "jsonlines":
+		return formatNDJSON, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported source format '%s'", source.Format)
+	}
+
+	switch strings.ToLower(filepath.Ext(trimCompressionExt(path))) {
+	case ".ndjson", ".jsonl":
+		return formatNDJSON, nil
+	default:
+		return formatJSON, nil
+	}
+}
+
+// decodeNumbers unmarshals data keeping numbers as json.Number
+func decodeNumbers(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package parse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// Surrogate key strategies
+const (
+	keyRowID = "row_id"
+	keyUUID7 = "uuid7"
+	keyHash  = "hash"
+)
+
+// noOrdinal is the ordinal of rows that were not read from a JSON array
+const noOrdinal = -1
+
+// rowRef identifies a JSON object read by a table
+type rowRef struct {
+	table string
+	id    uintptr
+}
+
+// boundRow is a row written by a table with child tables, and the context it was written in
+type boundRow struct {
+	data map[string]interface{}
+	ctx  map[string]interface{}
+}
+
+// surrogateKeyType returns the column type of a key strategy
+func surrogateKeyType(strategy string) string {
+	if strategy == keyRowID {
+		return "int64"
+	}
+	return "string"
+}
+
+// injectSurrogateKeys adds the surrogate key and ordinal columns to their tables, and the
+// parent's key column to every parent_refs entry naming a table with a surrogate key
+func injectSurrogateKeys(config *models.ParseConfig) error {
+	for i := range config.Tables {
+		tableConfig := &config.Tables[i]
+
+		var generated []models.FieldConfig
+		if tableConfig.SurrogateKey != nil {
+			key := *tableConfig.SurrogateKey
+			if key.Name == "" {
+				key.Name = tableConfig.Name + "_key"
+			}
+			switch key.Strategy {
+			case "":
+				key.Strategy = keyRowID
+			case keyRowID, keyUUID7, keyHash:
+			default:
+				return fmt.Errorf("table %s: unknown surrogate_key strategy %q (expected row_id, uuid7 or hash)", tableConfig.Name, key.Strategy)
+			}
+			tableConfig.SurrogateKey = &key
+			generated = append(generated, models.FieldConfig{Name: key.Name, Type: surrogateKeyType(key.Strategy), Required: true})
+		}
+		if tableConfig.OrdinalColumn != "" {
+			generated = append(generated, models.FieldConfig{Name: tableConfig.OrdinalColumn, Type: "int64"})
+		}
+
+		for _, field := range generated {
+			if err := checkColumnName(*tableConfig, field.Name); err != nil {
+				return err
+			}
+		}
+		tableConfig.Fields = append(generated, tableConfig.Fields...)
+	}
+
+	byName, err := tablesByName(config)
+	if err != nil {
+		return err
+	}
+	for i := range config.Tables {
+		tableConfig := &config.Tables[i]
+		for j := range tableConfig.ParentRefs {
+			parentRef := &tableConfig.ParentRefs[j]
+			// Unresolved references are reported when the table tree is built
+			parent, ok := byName[parentRef.EntityName]
+			if !ok || parent.SurrogateKey == nil || isParentKeyField(parent, findField(parentRef.Fields, parent.SurrogateKey.Name)) {
+				continue
+			}
+			if err := checkColumnName(*tableConfig, parent.SurrogateKey.Name); err != nil {
+				return err
+			}
+			parentRef.Fields = append(parentRef.Fields, models.FieldConfig{
+				Name: parent.SurrogateKey.Name,
+				Type: surrogateKeyType(parent.SurrogateKey.Strategy),
+			})
+		}
+	}
+	return nil
+}
+
+// checkColumnName reports a generated column clashing with a column of the table
+func checkColumnName(tableConfig models.TableConfig, name string) error {
+	if findField(getAllFields(tableConfig), name) != nil {
+		return fmt.Errorf("table %s: generated column %s clashes with a field of the same name", tableConfig.Name, name)
+	}
+	return nil
+}
+
+// findField returns the field with the given name, or nil
+func findField(fields []models.FieldConfig, name string) *models.FieldConfig {
+	for i := range fields {
+		if fields[i].Name == name {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// isParentKeyField reports whether a parent_refs field holds the parent's surrogate key:
+// it is named after the key and reads no value of its own
+func isParentKeyField(parent models.TableConfig, field *models.FieldConfig) bool {
+	return field != nil && parent.SurrogateKey != nil && field.Name == parent.SurrogateKey.Name && !hasSource(*field)
+}
+
+// hasSurrogateKeys reports whether any table has a surrogate key
+func hasSurrogateKeys(config *models.ParseConfig) bool {
+	for _, tableConfig := range config.Tables {
+		if tableConfig.SurrogateKey != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// resetRows forgets the rows, keys and positions of the previous root record
+func (gp *GenericParser) resetRows() {
+	clear(gp.written)
+	clear(gp.rows)
+	if gp.rowKeys == nil {
+		return
+	}
+	clear(gp.rowKeys)
+	clear(gp.positions)
+}
+
+// addRow records a row written by a table, and its surrogate key, so that the tables below bind it
+func (gp *GenericParser) addRow(tableConfig models.TableConfig, row map[string]interface{}, ctx map[string]interface{}, flatRecord models.GenericRecord) {
+	ref := rowRef{table: tableConfig.Name, id: objectID(row)}
+	gp.written[ref] = true
+	if tableConfig.SurrogateKey != nil {
+		key := flatRecord[tableConfig.SurrogateKey.Name]
+		gp.rowKeys[ref] = key
+		if id, ok := key.(int64); ok && tableConfig.SurrogateKey.Strategy == keyRowID {
+			gp.rowIDs[tableConfig.Name] = id
+		}
+	}
+	if len(gp.tables.children[tableConfig.Name]) > 0 {
+		gp.rows[tableConfig.Name] = append(gp.rows[tableConfig.Name], boundRow{data: row, ctx: ctx})
+	}
+}
+
+// wrote reports whether a table wrote an object as a row of the current root record
+func (gp *GenericParser) wrote(tableConfig models.TableConfig, obj map[string]interface{}) bool {
+	return gp.written[rowRef{table: tableConfig.Name, id: objectID(obj)}]
+}
+
+// setPosition records the array indexes leading from the root record to an object,
+// used by hash keys
+func (gp *GenericParser) setPosition(obj map[string]interface{}, indexes []int) {
+	if gp.positions != nil {
+		gp.positions[objectID(obj)] = indexes
+	}
+}
+
+// parentKey returns the surrogate key of a row written by a parent table from the current root record
+func (gp *GenericParser) parentKey(parent models.TableConfig, obj map[string]interface{}) (interface{}, error) {
+	key, ok := gp.rowKeys[rowRef{table: parent.Name, id: objectID(obj)}]
+	if !ok {
+		return nil, fmt.Errorf("no %s row was written for the bound %s object", parent.SurrogateKey.Name, parent.Name)
+	}
+	return key, nil
+}
+
+// newKey generates the surrogate key of a row about to be written. Nothing is recorded until
+// addRow, so rows filtered out or rejected never take a key (or a row_id) of their own.
+func (gp *GenericParser) newKey(tableConfig models.TableConfig, obj map[string]interface{}) (interface{}, error) {
+	switch tableConfig.SurrogateKey.Strategy {
+	case keyUUID7:
+		id, err := uuid.NewV7()
+		if err != nil {
+			return nil, fmt.Errorf("generating uuid7 key: %w", err)
+		}
+		return id.String(), nil
+	case keyHash:
+		return gp.hashKey(tableConfig, obj)
+	default:
+		return gp.rowIDs[tableConfig.Name] + 1, nil
+	}
+}
+
+// hashKey derives a deterministic key from where the object is (source file, root record,
+// table path and array indexes) and what it contains
+func (gp *GenericParser) hashKey(tableConfig models.TableConfig, obj map[string]interface{}) (string, error) {
+	content, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("hashing key: %w", err)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%v\x00", gp.sourceFile, gp.recordIndex, gp.tables.keys[tableConfig.Name], gp.positions[objectID(obj)])
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
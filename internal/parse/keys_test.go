@@ -0,0 +1,152 @@
+package parse
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// keyRecords are two root records; project 3 is dropped by the where predicate of keyConfig
+// and project 5, which has no status, by its required_policy
+var keyRecords = []string{
+	`{"projects": [
+		{"id": 1, "status": "open", "tasks": [{"id": 11}, {"id": 12}]},
+		{"id": 3, "status": "archived", "tasks": [{"id": 31}]},
+		{"id": 5, "tasks": [{"id": 51}]},
+		{"id": 2, "status": "open", "tasks": [{"id": 21}]}
+	]}`,
+	`{"projects": [{"id": 4, "status": "open", "tasks": [{"id": 41}, {"id": 42}]}]}`,
+}
+
+// keyConfig has projects and their tasks keyed with a strategy, and a table reading every
+// task from the root
+func keyConfig(strategy string) string {
+	return `
+required_policy: skip
+tables:
+  - name: projects
+    json_path: projects
+    where: "status != 'archived'"
+    surrogate_key: {strategy: ` + strategy + `}
+    ordinal_column: pos
+    fields:
+      - {name: id, json_path: id, type: int64}
+      - {name: status, json_path: status, type: string, required: true}
+  - name: tasks
+    parent: projects
+    json_path: tasks
+    surrogate_key: {strategy: ` + strategy + `}
+    fields: [{name: id, json_path: id, type: int64}]
+    parent_refs: [{entity_name: projects, fields: []}]
+  - name: all_tasks
+    json_path: projects.tasks
+    fields: [{name: id, json_path: id, type: int64}]
+    parent_refs: [{entity_name: projects, fields: []}]
+`
+}
+
+// parseKeyRecords parses keyRecords as the records of one input file
+func parseKeyRecords(t *testing.T, strategy string) map[string][]models.GenericRecord {
+	t.Helper()
+	gp, rows := newTestParser(t, keyConfig(strategy))
+	gp.sourceFile = "in.json"
+	for i, doc := range keyRecords {
+		gp.recordIndex = int64(i)
+		if err := gp.processRecord(decodeRecord(t, doc)); err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+	}
+	return rows
+}
+
+// keysByID maps the id column of rows to their key column, failing on empty or repeated keys
+func keysByID(t *testing.T, rows []models.GenericRecord, column string) map[string]interface{} {
+	t.Helper()
+	keys := make(map[string]interface{}, len(rows))
+	seen := make(map[interface{}]bool, len(rows))
+	for _, row := range rows {
+		key := row[column]
+		if key == nil || key == "" || seen[key] {
+			t.Fatalf("%s %v of row %v is empty or repeated", column, key, row["id"])
+		}
+		seen[key] = true
+		keys[fmt.Sprint(row["id"])] = key
+	}
+	return keys
+}
+
+func TestSurrogateKeys(t *testing.T) {
+	tests := []struct {
+		strategy string
+		stable   bool          // The same input yields the same keys
+		projects []interface{} // Keys of projects 1, 2 and 4, when known
+	}{
+		{strategy: "row_id", stable: true, projects: []interface{}{int64(1), int64(2), int64(3)}},
+		{strategy: "uuid7"},
+		{strategy: "hash", stable: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			rows := parseKeyRecords(t, tt.strategy)
+
+			// The filtered and rejected projects take no key, so the written ones stay consecutive
+			if got := strings.Join(renderRows(rows["projects"], "id", "pos"), ", "); got != "1 0, 2 3, 4 0" {
+				t.Errorf("projects = [%s], want ids 1, 2 and 4 at positions 0, 3 and 0", got)
+			}
+			projects := keysByID(t, rows["projects"], "projects_key")
+			for i, want := range tt.projects {
+				if got := rows["projects"][i]["projects_key"]; got != want {
+					t.Errorf("key of project %v = %v, want %v", rows["projects"][i]["id"], got, want)
+				}
+			}
+			keysByID(t, rows["tasks"], "tasks_key")
+
+			// Child rows carry the key of the project they were read from, or null when the
+			// project was not written
+			for _, table := range []string{"tasks", "all_tasks"} {
+				for _, row := range rows[table] {
+					id := row["id"].(int64)
+					want := projects[fmt.Sprint(id/10)]
+					if got := row["projects_key"]; got != want {
+						t.Errorf("%s %d: projects_key = %v, want %v", table, id, got, want)
+					}
+				}
+			}
+			if n := len(rows["tasks"]); n != 5 {
+				t.Errorf("got %d tasks, want the 5 tasks of written projects", n)
+			}
+
+			again := parseKeyRecords(t, tt.strategy)
+			for _, table := range []string{"projects", "tasks"} {
+				column := table + "_key"
+				for i, row := range rows[table] {
+					if same := again[table][i][column] == row[column]; same != tt.stable {
+						t.Errorf("%s %v: key %v, then %v on the same input", table, row["id"], row[column], again[table][i][column])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestHashKeysDependOnLocation(t *testing.T) {
+	gp, rows := newTestParser(t, keyConfig("hash"))
+	gp.sourceFile = "in.json"
+	// The same object in two root records, and twice in one array
+	for i := 0; i < 2; i++ {
+		gp.recordIndex = int64(i)
+		if err := gp.processRecord(decodeRecord(t, `{"projects": [{"id": 1, "status": "open"}, {"id": 1, "status": "open"}]}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seen := make(map[interface{}]bool)
+	for _, row := range rows["projects"] {
+		if key := row["projects_key"]; seen[key] {
+			t.Errorf("identical objects at different locations share key %v", key)
+		} else {
+			seen[key] = true
+		}
+	}
+}
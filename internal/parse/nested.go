@@ -0,0 +1,327 @@
+package parse
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/segmentio/parquet-go"
+)
+
+// Nested column kinds: list<T>, map<string,T> and struct (with sub-fields)
+const (
+	kindList   = "list"
+	kindMap    = "map"
+	kindStruct = "struct"
+)
+
+// nestedKind returns list, map or struct for nested column types, or "" for scalars
+func nestedKind(typeStr string) string {
+	typeStr = strings.TrimSpace(typeStr)
+	switch {
+	case typeStr == kindStruct:
+		return kindStruct
+	case strings.HasPrefix(typeStr, "list<") && strings.HasSuffix(typeStr, ">"):
+		return kindList
+	case strings.HasPrefix(typeStr, "map<") && strings.HasSuffix(typeStr, ">"):
+		return kindMap
+	}
+	return ""
+}
+
+// typeArgs returns the comma separated arguments between the outer angle brackets,
+// e.g. ["string", "list<int64>"] for "map<string,list<int64>>"
+func typeArgs(typeStr string) []string {
+	typeStr = strings.TrimSpace(typeStr)
+	inner := typeStr[strings.Index(typeStr, "<")+1 : len(typeStr)-1]
+
+	var args []string
+	depth, start := 0, 0
+	for i, c := range inner {
+		switch c {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(inner[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(args, strings.TrimSpace(inner[start:]))
+}
+
+// elementField describes the elements of a list, or the values of a map, as a field of their own.
+// Parsing options and sub-fields are inherited from the nested field.
+func elementField(field models.FieldConfig) models.FieldConfig {
+	args := typeArgs(field.Type)
+	elem := field
+	elem.JSONPath = ""
+	elem.JSONPaths = nil
+	elem.Required = false
+	if nestedKind(field.Type) == kindMap {
+		elem.Name = "value"
+		elem.Type = args[len(args)-1]
+	} else {
+		elem.Name = "element"
+		elem.Type = args[0]
+	}
+	return elem
+}
+
+// validateNestedFields checks the type of every column, recursing into elements and sub-fields
+func validateNestedFields(fields []models.FieldConfig) error {
+	for _, field := range fields {
+		if err := validateFieldType(field); err != nil {
+			return err
+		}
+		if hasSubFields(field) {
+			if err := validateNestedFields(field.Fields); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validateFieldType checks the type of a single column and of its list or map elements.
+// Sub-fields are not checked.
+func validateFieldType(field models.FieldConfig) error {
+	switch nestedKind(field.Type) {
+	case kindList, kindMap:
+		args := typeArgs(field.Type)
+		if nestedKind(field.Type) == kindList && len(args) != 1 {
+			return fmt.Errorf("field %s: list type must be list<T>, got %q", field.Name, field.Type)
+		}
+		if nestedKind(field.Type) == kindMap && (len(args) != 2 || args[0] != "string") {
+			return fmt.Errorf("field %s: map type must be map<string,T>, got %q", field.Name, field.Type)
+		}
+		elem := elementField(field)
+		switch nestedKind(elem.Type) {
+		case kindList, kindMap:
+			return fmt.Errorf("field %s: %s elements cannot be lists or maps, use a struct in between", field.Name, field.Type)
+		case kindStruct:
+			if len(field.Fields) == 0 {
+				return fmt.Errorf("field %s: %s type requires fields", field.Name, field.Type)
+			}
+			return nil
+		}
+		if err := validateScalarType(elem); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		return nil
+	case kindStruct:
+		if len(field.Fields) == 0 {
+			return fmt.Errorf("field %s: struct type requires fields", field.Name)
+		}
+		return nil
+	default:
+		return validateScalarType(field)
+	}
+}
+
+// validateScalarType checks a scalar column type and the options that go with it
+func validateScalarType(field models.FieldConfig) error {
+	name, arg := splitType(field.Type)
+	switch name {
+	case "":
+		return fmt.Errorf("field %s: type is required", field.Name)
+	case "decimal":
+		return validateDecimalFields([]models.FieldConfig{field})
+	case "timestamp", "time":
+		for _, unit := range []string{arg, field.Unit} {
+			if unit != "" && !isTimeUnit(unit) {
+				return fmt.Errorf("field %s: unknown time unit %q (expected ms, us or ns)", field.Name, unit)
+			}
+		}
+		_, err := fieldLocation(field)
+		return err
+	case "date":
+		if arg != "" {
+			return fmt.Errorf("field %s: type date takes no arguments, got %q", field.Name, field.Type)
+		}
+		_, err := fieldLocation(field)
+		return err
+	case "string", "json", "float64", "bool":
+	default:
+		if _, ok := integerTypes[name]; !ok {
+			return fmt.Errorf("field %s: unknown type %q", field.Name, field.Type)
+		}
+	}
+	if arg != "" {
+		return fmt.Errorf("field %s: type %s takes no arguments, got %q", field.Name, name, field.Type)
+	}
+	return nil
+}
+
+// hasSubFields reports whether a column takes its structure from fields: struct,
+// list<struct> and map<string,struct>
+func hasSubFields(field models.FieldConfig) bool {
+	switch nestedKind(field.Type) {
+	case kindStruct:
+		return true
+	case kindList, kindMap:
+		return nestedKind(elementField(field).Type) == kindStruct
+	}
+	return false
+}
+
+// convertNested converts a JSON array or object for a list, map or struct column.
+// Lists hold the converted non-null elements, maps the converted values (nil for null)
+// and structs a map keyed by sub-field name.
+func convertNested(value interface{}, field models.FieldConfig) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	switch nestedKind(field.Type) {
+	case kindList:
+		items, ok := value.([]interface{})
+		if !ok {
+			log.Debugf("field %s: expected an array, got %T", field.Name, value)
+			return nil, nil
+		}
+		elem := elementField(field)
+		list := make([]interface{}, 0, len(items))
+		for i, item := range items {
+			converted, err := convertField(item, elem)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", field.Name, i, err)
+			}
+			// list elements are required in the Parquet schema, nulls are dropped
+			if converted != nil {
+				list = append(list, converted)
+			}
+		}
+		return list, nil
+
+	case kindMap:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			log.Debugf("field %s: expected an object, got %T", field.Name, value)
+			return nil, nil
+		}
+		elem := elementField(field)
+		m := make(map[string]interface{}, len(obj))
+		for key, item := range obj {
+			converted, err := convertField(item, elem)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%q]: %w", field.Name, key, err)
+			}
+			m[key] = converted
+		}
+		return m, nil
+
+	default:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			log.Debugf("field %s: expected an object, got %T", field.Name, value)
+			return nil, nil
+		}
+		s := make(map[string]interface{}, len(field.Fields))
+		for _, sub := range field.Fields {
+			converted, err := convertField(fieldValue(obj, sub), sub)
+			if err != nil {
+				return nil, err
+			}
+			if converted == nil && sub.Required {
+				return nil, &RequiredFieldError{Field: field.Name + "." + sub.Name}
+			}
+			s[sub.Name] = converted
+		}
+		return s, nil
+	}
+}
+
+// nestedReflectType returns the Go type of a nested column. Map values are pointers so that
+// null values survive; nil slices and maps are written as null.
+func nestedReflectType(field models.FieldConfig) reflect.Type {
+	switch nestedKind(field.Type) {
+	case kindList:
+		return reflect.SliceOf(getReflectType(elementField(field)))
+	case kindMap:
+		return reflect.MapOf(reflect.TypeOf(""), reflect.PointerTo(getReflectType(elementField(field))))
+	default:
+		return structTypeOf(field.Fields)
+	}
+}
+
+// setNestedValue populates a list, map or struct value converted by convertNested
+func (dw *DynamicWriter) setNestedValue(field reflect.Value, value interface{}, fieldConfig models.FieldConfig) {
+	switch nestedKind(fieldConfig.Type) {
+	case kindList:
+		items, ok := value.([]interface{})
+		if !ok {
+			return
+		}
+		elem := elementField(fieldConfig)
+		list := reflect.MakeSlice(field.Type(), len(items), len(items))
+		for i, item := range items {
+			dw.setFieldValue(list.Index(i), item, elem)
+		}
+		field.Set(list)
+
+	case kindMap:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		elem := elementField(fieldConfig)
+		m := reflect.MakeMapWithSize(field.Type(), len(obj))
+		for key, item := range obj {
+			v := reflect.New(field.Type().Elem()).Elem()
+			if item != nil {
+				dw.setFieldValue(v, item, elem)
+			}
+			m.SetMapIndex(reflect.ValueOf(key), v)
+		}
+		field.Set(m)
+
+	default:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for i, sub := range fieldConfig.Fields {
+			if item, ok := obj[sub.Name]; ok && item != nil {
+				dw.setFieldValue(field.Field(i), item, sub)
+			}
+		}
+	}
+}
+
+// nestedNode applies logical types inside a nested column: the TIME, TIMESTAMP, DATE and
+// DECIMAL types of list elements, map values and struct sub-fields
+func nestedNode(field models.FieldConfig, reflected parquet.Node) parquet.Node {
+	var node parquet.Node
+	switch nestedKind(field.Type) {
+	case kindList:
+		// reflected is LIST → repeated group "list" → "element"
+		element := reflected.Fields()[0].Fields()[0]
+		node = parquet.List(columnNode(elementField(field), element))
+	case kindMap:
+		// reflected is MAP → repeated group "key_value" → "key", "value"
+		keyValue := reflected.Fields()[0].Fields()
+		node = parquet.Map(keyValue[0], columnNode(elementField(field), keyValue[1]))
+	default:
+		fields := reflected.Fields()
+		replaced := make([]parquet.Field, len(fields))
+		for i, sub := range fields {
+			replaced[i] = logicalColumnField{Node: columnNode(field.Fields[i], sub), field: sub}
+		}
+		node = logicalColumnsGroup{Node: parquet.Required(reflected), fields: replaced}
+	}
+
+	// Nil slices and maps stand for null, structs are nullable through their pointer
+	nullable := reflected.Optional()
+	if kind := nestedKind(field.Type); kind == kindList || kind == kindMap {
+		nullable = !field.Required
+	}
+	if nullable {
+		node = parquet.Optional(node)
+	}
+	return node
+}
@@ -0,0 +1,134 @@
+package parse
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/internal/fetch"
+	fetchs3 "github.com/kweheliye/json2parquet/internal/fetch/s3"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// OutputFile is the destination of a single Parquet file
+type OutputFile interface {
+	io.Writer
+	Close() error // Close finalizes the file
+	Abort() error // Abort discards whatever was written so far
+}
+
+// OutputStore creates Parquet files below the configured output path
+type OutputStore interface {
+	Create(name string) (OutputFile, error)
+	Location(name string) string
+	Remove(name string) error // Remove deletes a completed file
+}
+
+// NewOutputStore returns a store for a local directory or an s3://bucket/prefix/ output path
+func NewOutputStore(outputPath string, s3cfg models.S3Config) (OutputStore, error) {
+	if !fetchs3.IsS3URL(outputPath) {
+		if err := os.MkdirAll(outputPath, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+		return &localStore{dir: outputPath}, nil
+	}
+
+	if _, _, err := fetchs3.ParseURL(outputPath); err != nil {
+		return nil, err
+	}
+	awsCfg, err := fetchs3.NewAWSConfig(context.Background(), s3cfg)
+	if err != nil {
+		return nil, err
+	}
+	cfg := fetch.DefaultFetchConfig()
+	cfg.MaxRetries = 5
+	cfg.AWSConfig = awsCfg
+	cfg.S3UsePathStyle = s3cfg.ForcePathStyle
+	uploader, err := fetchs3.NewS3Uploader(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Store{prefix: strings.TrimSuffix(outputPath, "/"), uploader: uploader}, nil
+}
+
+// countingOutput tracks the number of bytes written to an output file
+type countingOutput struct {
+	OutputFile
+	written int64
+}
+
+func (c *countingOutput) Write(p []byte) (int, error) {
+	n, err := c.OutputFile.Write(p)
+	c.written += int64(n)
+	return n, err
+}
+
+// localStore writes files into a local directory
+type localStore struct {
+	dir string
+}
+
+func (s *localStore) Location(name string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(name))
+}
+
+func (s *localStore) Create(name string) (OutputFile, error) {
+	path := s.Location(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create output directory: %w", err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output file: %w", err)
+	}
+	return &localFile{File: file, store: s, name: name}, nil
+}
+
+// Remove deletes a file and the directories left empty by it, up to the output directory
+func (s *localStore) Remove(name string) error {
+	path := s.Location(name)
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	root := filepath.Clean(s.dir)
+	for dir := filepath.Dir(path); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// localFile is an output file on local disk; Abort removes the partial file
+type localFile struct {
+	*os.File
+	store *localStore
+	name  string
+}
+
+func (f *localFile) Abort() error {
+	f.File.Close()
+	return f.store.Remove(f.name)
+}
+
+// s3Store streams files to S3-compatible storage under a key prefix
+type s3Store struct {
+	prefix   string
+	uploader *fetchs3.S3Uploader
+}
+
+func (s *s3Store) Location(name string) string {
+	return s.prefix + "/" + name
+}
+
+func (s *s3Store) Create(name string) (OutputFile, error) {
+	return s.uploader.Open(s.Location(name))
+}
+
+func (s *s3Store) Remove(name string) error {
+	return s.uploader.Delete(s.Location(name))
+}
@@ -0,0 +1,286 @@
+package parse
+
+import (
+	"container/list"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// partitionFilenameTemplate names the files in a partition directory after the "part" base name
+const partitionFilenameTemplate = "-%04d.parquet"
+
+// hiveDefaultPartition is the directory value used for null or empty partition values
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// tableWriter is implemented by the writers the parser routes flattened records to
+type tableWriter interface {
+	Write(record models.GenericRecord) error
+	Close() error
+	Abort() error
+	Files() []string
+}
+
+// PartitionedWriter fans records out to one DynamicWriter per partition value set,
+// writing Hive-style directories: table/col1=v1/col2=v2/part-0000.parquet.
+// At most options.MaxOpenPartitions writers are open at once; the least recently used
+// one is closed to make room and a later record for it starts a new numbered file.
+type PartitionedWriter struct {
+	store       OutputStore
+	tableConfig models.TableConfig
+	fileConfig  models.TableConfig // table config without the partition columns
+	options     WriterOptions
+	columns     []string
+	fields      []models.FieldConfig // config of each partition column, formatting its values
+
+	open      map[string]*list.Element // partition dir → element holding *partitionEntry
+	lru       *list.List               // most recently used at the front
+	nextIndex map[string]int           // next file number per partition dir
+
+	names       []string // store names of the files of the partitions closed so far, removed by Abort
+	files       []string
+	recordCount int64
+	spills      int
+}
+
+type partitionEntry struct {
+	dir    string
+	writer *DynamicWriter
+}
+
+// NewPartitionedWriter creates a writer partitioning tableConfig by its partition_by columns
+func NewPartitionedWriter(store OutputStore, tableConfig models.TableConfig, options WriterOptions) (*PartitionedWriter, error) {
+	fileConfig, err := withoutPartitionColumns(tableConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files are always numbered so partitions reopened after a spill never overwrite earlier files.
+	// They are named part-0000.parquet whatever the table's filename_template.
+	options.NumberFiles = true
+	options.FilenameTemplate = partitionFilenameTemplate
+
+	byName := make(map[string]models.FieldConfig)
+	for _, field := range getAllFields(tableConfig) {
+		byName[field.Name] = field
+	}
+	fields := make([]models.FieldConfig, len(tableConfig.PartitionBy))
+	for i, col := range tableConfig.PartitionBy {
+		fields[i] = byName[col]
+	}
+
+	return &PartitionedWriter{
+		store:       store,
+		tableConfig: tableConfig,
+		fileConfig:  fileConfig,
+		options:     options,
+		columns:     tableConfig.PartitionBy,
+		fields:      fields,
+		open:        make(map[string]*list.Element),
+		lru:         list.New(),
+		nextIndex:   make(map[string]int),
+	}, nil
+}
+
+// withoutPartitionColumns drops the partition columns from the schema, their values live in the path
+func withoutPartitionColumns(tableConfig models.TableConfig) (models.TableConfig, error) {
+	partition := make(map[string]bool, len(tableConfig.PartitionBy))
+	for _, col := range tableConfig.PartitionBy {
+		partition[col] = true
+	}
+
+	found := make(map[string]bool, len(partition))
+	keep := func(fields []models.FieldConfig) []models.FieldConfig {
+		var kept []models.FieldConfig
+		for _, field := range fields {
+			if partition[field.Name] {
+				found[field.Name] = true
+				continue
+			}
+			kept = append(kept, field)
+		}
+		return kept
+	}
+
+	fileConfig := tableConfig
+	fileConfig.Fields = keep(tableConfig.Fields)
+	fileConfig.Provenance = keep(tableConfig.Provenance)
+	fileConfig.ParentRefs = make([]models.ParentRef, len(tableConfig.ParentRefs))
+	for i, ref := range tableConfig.ParentRefs {
+		ref.Fields = keep(ref.Fields)
+		fileConfig.ParentRefs[i] = ref
+	}
+
+	for _, col := range tableConfig.PartitionBy {
+		if !found[col] {
+			return fileConfig, fmt.Errorf("partition column %s is not a column of table %s", col, tableConfig.Name)
+		}
+	}
+	return fileConfig, nil
+}
+
+// Write routes the record to the writer of its partition
+func (pw *PartitionedWriter) Write(record models.GenericRecord) error {
+	dir := pw.partitionDir(record)
+
+	writer, err := pw.writerFor(dir)
+	if err != nil {
+		return err
+	}
+	if err := writer.Write(record); err != nil {
+		return err
+	}
+
+	pw.recordCount++
+	return nil
+}
+
+// partitionDir builds the col=value/... directory for a record
+func (pw *PartitionedWriter) partitionDir(record models.GenericRecord) string {
+	parts := make([]string, len(pw.columns))
+	for i, col := range pw.columns {
+		value := hiveDefaultPartition
+		if v, ok := record[col]; ok && v != nil {
+			if s := partitionValue(pw.fields[i], v); s != "" {
+				value = escapePartitionValue(s)
+			}
+		}
+		parts[i] = escapePartitionValue(col) + "=" + value
+	}
+	return strings.Join(parts, "/")
+}
+
+// partitionValue formats a converted column value for a partition directory the way query
+// engines read it back: dates as 2006-01-02, timestamps as RFC 3339, numbers and booleans
+// as literals and decimals with their scale applied
+func partitionValue(field models.FieldConfig, value interface{}) string {
+	switch v := value.(type) {
+	case *big.Int:
+		_, scale, _ := decimalSpec(field)
+		return new(big.Rat).SetFrac(v, pow10(scale)).FloatString(scale)
+	case time.Time:
+		switch baseType(field.Type) {
+		case "date":
+			return v.Format(time.DateOnly)
+		case "time":
+			return v.Format("15:04:05.999999999")
+		default:
+			return v.Format(time.RFC3339Nano)
+		}
+	case bool:
+		return strconv.FormatBool(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// writerFor returns the open writer of a partition, opening one and evicting the
+// least recently used writer when the cap is reached
+func (pw *PartitionedWriter) writerFor(dir string) (*DynamicWriter, error) {
+	if elem, ok := pw.open[dir]; ok {
+		pw.lru.MoveToFront(elem)
+		return elem.Value.(*partitionEntry).writer, nil
+	}
+
+	for pw.lru.Len() >= pw.options.MaxOpenPartitions {
+		if err := pw.closeEntry(pw.lru.Back()); err != nil {
+			return nil, err
+		}
+		pw.spills++
+	}
+
+	options := pw.options
+	options.FirstFileIndex = pw.nextIndex[dir]
+	writer, err := NewDynamicWriter(pw.store, pw.tableConfig.Name+"/"+dir+"/part", pw.fileConfig, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create writer for partition %s: %w", dir, err)
+	}
+	writer.quiet = true
+
+	pw.open[dir] = pw.lru.PushFront(&partitionEntry{dir: dir, writer: writer})
+	return writer, nil
+}
+
+// closeEntry closes a partition writer and records its files
+func (pw *PartitionedWriter) closeEntry(elem *list.Element) error {
+	entry := pw.lru.Remove(elem).(*partitionEntry)
+	delete(pw.open, entry.dir)
+
+	if err := entry.writer.Close(); err != nil {
+		// The partition is no longer tracked, so discard what it wrote right away
+		if abortErr := entry.writer.Abort(); abortErr != nil {
+			log.Errorf("Failed to abort partition %s: %v", entry.dir, abortErr)
+		}
+		return fmt.Errorf("failed to close partition %s: %w", entry.dir, err)
+	}
+	pw.names = append(pw.names, entry.writer.names...)
+	pw.files = append(pw.files, entry.writer.Files()...)
+	pw.nextIndex[entry.dir] = entry.writer.fileIndex + 1
+	return nil
+}
+
+// Close closes all open partition writers
+func (pw *PartitionedWriter) Close() error {
+	var firstErr error
+	for pw.lru.Len() > 0 {
+		if err := pw.closeEntry(pw.lru.Front()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	log.Infof("Wrote %d records to table: %s (%d files in %d partitions, %d writer spills)",
+		pw.recordCount, pw.tableConfig.Name, len(pw.files), len(pw.nextIndex), pw.spills)
+	return nil
+}
+
+// Abort discards the files still being written and removes the files of the partitions
+// closed earlier, so a failed run leaves no incomplete partitions behind
+func (pw *PartitionedWriter) Abort() error {
+	var firstErr error
+	for elem := pw.lru.Front(); elem != nil; elem = elem.Next() {
+		if err := elem.Value.(*partitionEntry).writer.Abort(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	for _, name := range pw.names {
+		if err := pw.store.Remove(name); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove %s: %w", pw.store.Location(name), err)
+		}
+	}
+	pw.lru.Init()
+	pw.open = make(map[string]*list.Element)
+	pw.names, pw.files = nil, nil
+	return firstErr
+}
+
+// Files returns the locations of the files completed so far
+func (pw *PartitionedWriter) Files() []string {
+	return pw.files
+}
+
+// escapePartitionValue percent-encodes characters that are unsafe in Hive partition paths
+func escapePartitionValue(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < 0x20 || c == 0x7F || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
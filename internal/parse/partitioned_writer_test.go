@@ -0,0 +1,62 @@
+package parse
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFailedRunRemovesClosedFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+	}{
+		// Partitions a and b are closed to make room before the overflow in record 3
+		{name: "evicted partitions", table: `partition_by: [k]
+    max_open_partitions: 1`},
+		// Files completed by rolling over before the overflow
+		{name: "rolled files", table: `max_rows_per_file: 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			input := filepath.Join(dir, "in.ndjson")
+			output := filepath.Join(dir, "out")
+			writeFile(t, input, `{"k": "a", "n": 1}
+{"k": "b", "n": 2}
+{"k": "c", "n": 70000}
+`)
+			config := filepath.Join(dir, "config.yaml")
+			writeFile(t, config, `
+source: {type: file, path: `+input+`}
+output_path: `+output+`
+tables:
+  - name: t
+    json_path: ""
+    `+tt.table+`
+    fields:
+      - {name: k, json_path: k, type: string}
+      - {name: n, json_path: n, type: int16}
+`)
+
+			gp, err := NewGenericParser(config)
+			if err != nil {
+				t.Fatalf("NewGenericParser: %v", err)
+			}
+			if err := gp.ParseFile(input); err == nil {
+				t.Fatal("ParseFile succeeded despite an int16 overflow")
+			}
+
+			var left []string
+			filepath.Walk(output, func(path string, info os.FileInfo, err error) error {
+				if err == nil && path != output {
+					left = append(left, path)
+				}
+				return nil
+			})
+			if len(left) != 0 {
+				t.Fatalf("a failed run left %v behind", left)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/kweheliye/json2parquet/internal/jsonpath"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// compiledPaths caches compiled JSONPath expressions by their source text
+var compiledPaths sync.Map
+
+// compilePath compiles an expression once and caches the result
+func compilePath(expr string) (*jsonpath.Path, error) {
+	if p, ok := compiledPaths.Load(expr); ok {
+		return p.(*jsonpath.Path), nil
+	}
+	p, err := jsonpath.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	compiledPaths.Store(expr, p)
+	return p, nil
+}
+
+// foldedPaths caches the case insensitive variants of compiled paths
+var foldedPaths sync.Map
+
+// pathOf returns the compiled path of an expression validated by compileConfigPaths
+func pathOf(expr string) *jsonpath.Path {
+	p, err := compilePath(expr)
+	if err != nil {
+		// Expressions are validated when the config is loaded
+		panic(err)
+	}
+	return p
+}
+
+// foldedPathOf is pathOf matching member names ignoring case
+func foldedPathOf(expr string) *jsonpath.Path {
+	if p, ok := foldedPaths.Load(expr); ok {
+		return p.(*jsonpath.Path)
+	}
+	p := pathOf(expr).CaseInsensitive()
+	foldedPaths.Store(expr, p)
+	return p
+}
+
+// fieldPaths returns the paths a field reads from: its json_paths candidates, or its json_path.
+// A field without a path reads nothing, rather than the whole object "" would select.
+func fieldPaths(field models.FieldConfig) []string {
+	switch {
+	case len(field.JSONPaths) > 0:
+		return field.JSONPaths
+	case field.JSONPath != "":
+		return []string{field.JSONPath}
+	}
+	return nil
+}
+
+// hasSource reports whether a field reads a value of its own, from a path or an expression
+func hasSource(field models.FieldConfig) bool {
+	return field.JSONPath != "" || len(field.JSONPaths) > 0 || field.Expr != ""
+}
+
+// fieldValue reads a field from data: the value of the first of its paths that is not null
+func fieldValue(data map[string]interface{}, field models.FieldConfig) interface{} {
+	for _, path := range fieldPaths(field) {
+		if value := getValueFromPath(data, path, field.CaseInsensitive); value != nil {
+			return value
+		}
+	}
+	return nil
+}
+
+// compileConfigPaths compiles the json_path of every table and field so that invalid
+// expressions are reported when the config is loaded
+func compileConfigPaths(config *models.ParseConfig) error {
+	for _, tableConfig := range config.Tables {
+		if _, err := compilePath(tableConfig.JSONPath); err != nil {
+			return fmt.Errorf("table %s: %w", tableConfig.Name, err)
+		}
+		if err := compileFieldPaths(getAllFields(tableConfig)); err != nil {
+			return fmt.Errorf("table %s: %w", tableConfig.Name, err)
+		}
+	}
+	return nil
+}
+
+// compileFieldPaths compiles field paths, including the sub-fields of struct columns
+func compileFieldPaths(fields []models.FieldConfig) error {
+	for _, field := range fields {
+		for _, path := range fieldPaths(field) {
+			if _, err := compilePath(path); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		if err := compileFieldPaths(field.Fields); err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
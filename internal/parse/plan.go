@@ -0,0 +1,300 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// Column origins reported by a plan
+const (
+	originField        = "field"
+	originParentRef    = "parent_ref"
+	originParentKey    = "parent_key"
+	originSurrogateKey = "surrogate_key"
+	originOrdinal      = "ordinal"
+	originUnmapped     = "unmapped"
+	originProvenance   = "provenance"
+)
+
+// PlanOptions controls a dry run of the parser
+type PlanOptions struct {
+	Limit      int // Root records read across all inputs, 0 reads everything
+	SampleRows int // Rows kept per table for the preview
+}
+
+// Plan is the outcome of a dry run: the resolved schema of every table, a sample of its rows
+// and the configured paths that never matched
+type Plan struct {
+	Records   int             `json:"records"`
+	Tables    []*TablePlan    `json:"tables"`
+	Unmatched []UnmatchedPath `json:"unmatched"`
+	Failures  []PlanFailure   `json:"failures,omitempty"`
+}
+
+// TablePlan describes what a table would be written as
+type TablePlan struct {
+	Name        string                 `json:"name"`
+	Parent      string                 `json:"parent,omitempty"`
+	JSONPath    string                 `json:"json_path"`
+	Where       string                 `json:"where,omitempty"`
+	PartitionBy []string               `json:"partition_by,omitempty"`
+	Schema      string                 `json:"schema"` // Parquet schema of the table's files
+	Columns     []PlanColumn           `json:"columns"`
+	Rows        int64                  `json:"rows"`     // Rows that would be written
+	Skipped     int64                  `json:"skipped"`  // Rows missing a required field or holding an invalid value
+	Filtered    int64                  `json:"filtered"` // Rows not matching the where predicate
+	Sample      []models.GenericRecord `json:"sample"`   // First rows, with values as they read back from Parquet
+
+	fields []models.FieldConfig
+}
+
+// PlanColumn is a column of a table and how often it held a value
+type PlanColumn struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Required  bool     `json:"required"`
+	Origin    string   `json:"origin"`           // field, parent_ref, parent_key, surrogate_key, ordinal, unmapped or provenance
+	Entity    string   `json:"entity,omitempty"` // Table named by the parent_refs entry of parent_ref and parent_key columns
+	JSONPath  string   `json:"json_path,omitempty"`
+	JSONPaths []string `json:"json_paths,omitempty"` // Candidate paths, the first non-null value wins
+	Expr      string   `json:"expr,omitempty"`
+	Values    int64    `json:"values"` // Rows in which the column is not null
+}
+
+// UnmatchedPath is a configured json_path that matched nothing in a dry run: a table's path
+// that selected no rows, or a column's path that never held a value
+type UnmatchedPath struct {
+	Table     string   `json:"table"`
+	Column    string   `json:"column,omitempty"`
+	JSONPath  string   `json:"json_path"`
+	JSONPaths []string `json:"json_paths,omitempty"` // Set instead of JSONPath for a column with candidate paths
+}
+
+// PlanFailure is a record error met in a dry run, with the number of records it occurred in
+type PlanFailure struct {
+	Message string `json:"message"`
+	Records int    `json:"records"`
+}
+
+// Plan runs the table traversal over the first root records of the inputs without writing
+// anything. Rows are counted and sampled instead; rows missing a required field or holding a value
+// that cannot be converted are counted as skipped whatever the required_policy, and rows not matching a where predicate as filtered.
+func (gp *GenericParser) Plan(inputs []InputFile, opts PlanOptions) (*Plan, error) {
+	plan := &Plan{Unmatched: []UnmatchedPath{}}
+	byName := make(map[string]*TablePlan, len(gp.config.Tables))
+	for _, tableConfig := range gp.config.Tables {
+		table, err := gp.tablePlan(tableConfig)
+		if err != nil {
+			return nil, err
+		}
+		plan.Tables = append(plan.Tables, table)
+		byName[table.Name] = table
+	}
+
+	policies := gp.requiredPolicies
+	gp.requiredPolicies = make(map[string]string, len(policies))
+	for name := range policies {
+		gp.requiredPolicies[name] = policySkip
+	}
+	gp.rowSink = func(tableConfig models.TableConfig, record models.GenericRecord) error {
+		table := byName[tableConfig.Name]
+		table.Rows++
+		for i, col := range table.Columns {
+			if record[col.Name] != nil {
+				table.Columns[i].Values++
+			}
+		}
+		if len(table.Sample) < opts.SampleRows {
+			table.Sample = append(table.Sample, displayRecord(table.fields, record))
+		}
+		return nil
+	}
+	defer func() {
+		gp.requiredPolicies = policies
+		gp.rowSink = nil
+	}()
+
+	failures := make(map[string]int)
+	fail := func(msg string) {
+		if failures[msg] == 0 {
+			plan.Failures = append(plan.Failures, PlanFailure{Message: msg})
+		}
+		failures[msg]++
+	}
+
+	for _, input := range inputs {
+		limit := 0
+		if opts.Limit > 0 {
+			if limit = opts.Limit - plan.Records; limit <= 0 {
+				break
+			}
+		}
+
+		gp.sourceFile = input.Origin
+		n, err := streamInput(input, gp.config.Source, limit, func(i int, record interface{}) error {
+			recordMap, ok := record.(map[string]interface{})
+			if !ok {
+				fail(fmt.Sprintf("root record is a %T, not an object", record))
+				return nil
+			}
+			gp.recordIndex = int64(i)
+			if err := gp.processRecord(recordMap); err != nil {
+				fail(err.Error())
+			}
+			return nil
+		})
+		plan.Records += n
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", input.Origin, err)
+		}
+	}
+
+	for i := range plan.Failures {
+		plan.Failures[i].Records = failures[plan.Failures[i].Message]
+	}
+	for _, table := range plan.Tables {
+		table.Skipped = gp.skipped[table.Name]
+		table.Filtered = gp.filtered[table.Name]
+		if table.Rows == 0 && table.Skipped == 0 && table.Filtered == 0 {
+			plan.Unmatched = append(plan.Unmatched, UnmatchedPath{Table: table.Name, JSONPath: table.JSONPath})
+			continue
+		}
+		for _, col := range table.Columns {
+			if table.Rows > 0 && col.Values == 0 && (col.JSONPath != "" || len(col.JSONPaths) > 0) {
+				plan.Unmatched = append(plan.Unmatched, UnmatchedPath{Table: table.Name, Column: col.Name, JSONPath: col.JSONPath, JSONPaths: col.JSONPaths})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// tablePlan resolves the columns and file schema of a table
+func (gp *GenericParser) tablePlan(tableConfig models.TableConfig) (*TablePlan, error) {
+	table := &TablePlan{
+		Name:        tableConfig.Name,
+		Parent:      tableConfig.Parent,
+		JSONPath:    tableConfig.JSONPath,
+		Where:       tableConfig.Where,
+		PartitionBy: tableConfig.PartitionBy,
+		fields:      getAllFields(tableConfig),
+	}
+
+	for _, parentRef := range tableConfig.ParentRefs {
+		parent := gp.tables.byName[parentRef.EntityName]
+		for _, field := range parentRef.Fields {
+			col := planColumn(field, originParentRef)
+			col.Entity = parentRef.EntityName
+			if isParentKeyField(parent, &field) {
+				col.Origin = originParentKey
+			}
+			table.Columns = append(table.Columns, col)
+		}
+	}
+	for _, field := range tableConfig.Fields {
+		origin := originField
+		switch {
+		case field.Name == tableConfig.CaptureUnmapped:
+			origin = originUnmapped
+		case tableConfig.SurrogateKey != nil && field.Name == tableConfig.SurrogateKey.Name:
+			origin = originSurrogateKey
+		case field.Name == tableConfig.OrdinalColumn:
+			origin = originOrdinal
+		}
+		table.Columns = append(table.Columns, planColumn(field, origin))
+	}
+	for _, field := range tableConfig.Provenance {
+		table.Columns = append(table.Columns, planColumn(field, originProvenance))
+	}
+
+	// Partition columns live in the directory names, not in the files
+	fileConfig := tableConfig
+	if len(tableConfig.PartitionBy) > 0 {
+		var err error
+		if fileConfig, err = withoutPartitionColumns(tableConfig); err != nil {
+			return nil, err
+		}
+	}
+	_, schema := tableSchema(fileConfig)
+	table.Schema = schema.String()
+	return table, nil
+}
+
+func planColumn(field models.FieldConfig, origin string) PlanColumn {
+	return PlanColumn{
+		Name:      field.Name,
+		Type:      field.Type,
+		Required:  field.Required,
+		Origin:    origin,
+		JSONPath:  field.JSONPath,
+		JSONPaths: field.JSONPaths,
+		Expr:      field.Expr,
+	}
+}
+
+// displayRecord converts the values of a flattened row with displayValue
+func displayRecord(fields []models.FieldConfig, record models.GenericRecord) models.GenericRecord {
+	row := make(models.GenericRecord, len(fields))
+	for _, field := range fields {
+		row[field.Name] = displayValue(field, record[field.Name])
+	}
+	return row
+}
+
+// displayValue converts a converted column value to what reads back from the Parquet file:
+// decimals with their scale, temporal values as text, json columns as JSON and nested
+// values element by element
+func displayValue(field models.FieldConfig, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+
+	switch nestedKind(field.Type) {
+	case kindList:
+		items, _ := value.([]interface{})
+		elem := elementField(field)
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = displayValue(elem, item)
+		}
+		return list
+	case kindMap:
+		obj, _ := value.(map[string]interface{})
+		elem := elementField(field)
+		m := make(map[string]interface{}, len(obj))
+		for key, item := range obj {
+			m[key] = displayValue(elem, item)
+		}
+		return m
+	case kindStruct:
+		obj, _ := value.(map[string]interface{})
+		s := make(map[string]interface{}, len(field.Fields))
+		for _, sub := range field.Fields {
+			s[sub.Name] = displayValue(sub, obj[sub.Name])
+		}
+		return s
+	}
+
+	switch v := value.(type) {
+	case *big.Int:
+		_, scale, _ := decimalSpec(field)
+		return new(big.Rat).SetFrac(v, pow10(scale)).FloatString(scale)
+	case time.Time:
+		switch baseType(field.Type) {
+		case "date":
+			return v.Format(time.DateOnly)
+		case "time":
+			return v.Format("15:04:05.999999999")
+		default:
+			return v.Format(time.RFC3339Nano)
+		}
+	case string:
+		if field.Type == "json" {
+			return json.RawMessage(v)
+		}
+	}
+	return value
+}
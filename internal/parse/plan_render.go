@@ -0,0 +1,129 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxCellWidth truncates long values in the text rendering of sample rows
+const maxCellWidth = 40
+
+// WriteJSON writes the plan as indented JSON
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// WriteText writes the plan for a terminal: per table its columns, Parquet schema and sample
+// rows, followed by the paths that never matched and the record failures
+func (p *Plan) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Dry run over %d root records\n", p.Records)
+
+	for _, table := range p.Tables {
+		fmt.Fprintf(tw, "\nTable %s: %d rows", table.Name, table.Rows)
+		if table.Skipped > 0 {
+			fmt.Fprintf(tw, ", %d skipped for missing required fields or invalid values", table.Skipped)
+		}
+		if table.Filtered > 0 {
+			fmt.Fprintf(tw, ", %d filtered out", table.Filtered)
+		}
+		fmt.Fprintf(tw, "\n  json_path: %q", table.JSONPath)
+		if table.Parent != "" {
+			fmt.Fprintf(tw, " under %s", table.Parent)
+		}
+		if table.Where != "" {
+			fmt.Fprintf(tw, "\n  where: %s", table.Where)
+		}
+		if len(table.PartitionBy) > 0 {
+			fmt.Fprintf(tw, "\n  partition_by: %s", strings.Join(table.PartitionBy, ", "))
+		}
+		fmt.Fprint(tw, "\n\n  COLUMN\tTYPE\tREQUIRED\tORIGIN\tSOURCE\tVALUES\n")
+		for _, col := range table.Columns {
+			origin := col.Origin
+			if col.Entity != "" {
+				origin += " " + col.Entity
+			}
+			source := col.JSONPath
+			switch {
+			case col.Expr != "":
+				source = "= " + col.Expr
+			case len(col.JSONPaths) > 0:
+				source = strings.Join(col.JSONPaths, " | ")
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t%t\t%s\t%s\t%d\n", col.Name, col.Type, col.Required, origin, source, col.Values)
+		}
+
+		fmt.Fprint(tw, "\n")
+		for _, line := range strings.Split(strings.TrimRight(table.Schema, "\n"), "\n") {
+			fmt.Fprintf(tw, "  %s\n", line)
+		}
+
+		if len(table.Sample) > 0 {
+			cells := make([]string, len(table.Columns))
+			for i, col := range table.Columns {
+				cells[i] = col.Name
+			}
+			fmt.Fprintf(tw, "\n  %s\n", strings.Join(cells, "\t"))
+			for _, row := range table.Sample {
+				for i, col := range table.Columns {
+					cells[i] = formatCell(row[col.Name])
+				}
+				fmt.Fprintf(tw, "  %s\n", strings.Join(cells, "\t"))
+			}
+		}
+		// Flush per table so that column widths do not spread across tables
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(p.Unmatched) == 0 {
+		fmt.Fprint(tw, "\nEvery configured path matched\n")
+	} else {
+		fmt.Fprint(tw, "\nPaths that never matched:\n")
+		for _, u := range p.Unmatched {
+			if u.Column == "" {
+				fmt.Fprintf(tw, "  table %s: json_path %q selected no rows\n", u.Table, u.JSONPath)
+			} else if len(u.JSONPaths) > 0 {
+				fmt.Fprintf(tw, "  table %s: column %s: none of json_paths %q ever held a value\n", u.Table, u.Column, u.JSONPaths)
+			} else {
+				fmt.Fprintf(tw, "  table %s: column %s: json_path %q never held a value\n", u.Table, u.Column, u.JSONPath)
+			}
+		}
+	}
+	if len(p.Failures) > 0 {
+		fmt.Fprint(tw, "\nRecord failures:\n")
+		for _, f := range p.Failures {
+			fmt.Fprintf(tw, "  %d records: %s\n", f.Records, f.Message)
+		}
+	}
+	return tw.Flush()
+}
+
+// formatCell renders a sample value on a single line
+func formatCell(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		s = v
+	case json.RawMessage:
+		s = string(v)
+	case []interface{}, map[string]interface{}:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		s = string(data)
+	default:
+		s = fmt.Sprint(v)
+	}
+	s = strings.NewReplacer("\n", " ", "\t", " ").Replace(s)
+	return truncate(s, maxCellWidth)
+}
@@ -0,0 +1,89 @@
+package parse
+
+import (
+	"reflect"
+
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/segmentio/parquet-go"
+)
+
+// logicalColumnField replaces the node of a reflect-generated field with a logical type
+// that parquet-go struct tags cannot express, such as TIME or a nullable TIMESTAMP
+type logicalColumnField struct {
+	parquet.Node
+	field parquet.Field
+}
+
+func (f logicalColumnField) Name() string { return f.field.Name() }
+
+func (f logicalColumnField) Value(base reflect.Value) reflect.Value { return f.field.Value(base) }
+
+// logicalColumnsGroup is the root schema node with the logical columns substituted
+type logicalColumnsGroup struct {
+	parquet.Node
+	fields []parquet.Field
+}
+
+func (g logicalColumnsGroup) Fields() []parquet.Field { return g.fields }
+
+// logicalNode returns the node of a column whose logical type is applied after schema generation
+func logicalNode(field models.FieldConfig) (parquet.Node, bool) {
+	switch baseType(field.Type) {
+	case "timestamp":
+		return parquet.Timestamp(parquetTimeUnit(timeUnitOf(field))), true
+	case "date":
+		return parquet.Date(), true
+	case "json":
+		return parquet.JSON(), true
+	case "time":
+		return parquet.Time(parquetTimeUnit(timeUnitOf(field))), true
+	case "decimal":
+		precision, scale, err := decimalSpec(field)
+		if err != nil {
+			return nil, false
+		}
+		return parquet.Decimal(scale, precision, decimalPhysicalType(precision)), true
+	}
+	return nil, false
+}
+
+// columnNode returns the node of a column with its logical types applied, starting from the
+// node parquet-go derived from the generated struct field
+func columnNode(field models.FieldConfig, reflected parquet.Node) parquet.Node {
+	if nestedKind(field.Type) != "" {
+		return nestedNode(field, reflected)
+	}
+	if node, ok := logicalNode(field); ok {
+		if reflected.Optional() {
+			node = parquet.Optional(node)
+		}
+		return node
+	}
+	return reflected
+}
+
+// hasLogicalTypes reports whether any column needs its node replaced
+func hasLogicalTypes(fields []models.FieldConfig) bool {
+	for _, field := range fields {
+		if _, ok := logicalNode(field); ok || nestedKind(field.Type) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// withLogicalTypes returns the schema with the logical types of temporal, decimal and nested columns applied.
+// fields must be in the order of the generated struct fields.
+func withLogicalTypes(schema *parquet.Schema, fields []models.FieldConfig) *parquet.Schema {
+	if !hasLogicalTypes(fields) {
+		return schema
+	}
+
+	columns := schema.Fields()
+	replaced := make([]parquet.Field, len(columns))
+	for i, column := range columns {
+		replaced[i] = logicalColumnField{Node: columnNode(fields[i], column), field: column}
+	}
+
+	return parquet.NewSchema(schema.Name(), logicalColumnsGroup{Node: schema, fields: replaced})
+}
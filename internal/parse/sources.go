@@ -0,0 +1,93 @@
+package parse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// InputFile is a local file to parse together with the source it was obtained from
+type InputFile struct {
+	LocalPath       string // Path of the file on local disk
+	Origin          string // Original source path or URL, used for provenance
+	ContentEncoding string // Content-Encoding reported when the file was fetched, if any
+}
+
+// ExpandSourcePaths resolves configured source paths into concrete sources.
+// Local globs are expanded, directories are replaced by the regular files they contain,
+// and remote URLs are returned unchanged. Results keep the configured order; the
+// matches of each glob or directory are sorted by name.
+func ExpandSourcePaths(paths []string) ([]string, error) {
+	var expanded []string
+
+	for _, p := range paths {
+		if isRemotePath(p) {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		if strings.ContainsAny(p, "*?[") {
+			matches, err := filepath.Glob(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid glob %s: %w", p, err)
+			}
+			files := regularFiles(matches)
+			if len(files) == 0 {
+				return nil, fmt.Errorf("glob %s matched no files", p)
+			}
+			expanded = append(expanded, files...)
+			continue
+		}
+
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat source %s: %w", p, err)
+		}
+		if !info.IsDir() {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list source directory %s: %w", p, err)
+		}
+		var files []string
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			files = append(files, filepath.Join(p, entry.Name()))
+		}
+		files = regularFiles(files)
+		if len(files) == 0 {
+			return nil, fmt.Errorf("source directory %s contains no files", p)
+		}
+		expanded = append(expanded, files...)
+	}
+
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("no source path configured")
+	}
+
+	return expanded, nil
+}
+
+// regularFiles filters paths down to regular files and sorts them
+func regularFiles(paths []string) []string {
+	var files []string
+	for _, p := range paths {
+		if info, err := os.Stat(p); err == nil && info.Mode().IsRegular() {
+			files = append(files, p)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// isRemotePath reports whether the path carries a URL scheme such as http:// or s3://
+func isRemotePath(p string) bool {
+	return strings.Contains(p, "://")
+}
@@ -0,0 +1,276 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/segmentio/parquet-go"
+)
+
+// Time units for timestamp and time columns
+const (
+	unitMillis = "ms"
+	unitMicros = "us"
+	unitNanos  = "ns"
+)
+
+// splitType separates a type string such as "timestamp(us)" into its name and argument
+func splitType(typeStr string) (string, string) {
+	typeStr = strings.TrimSpace(typeStr)
+	if i := strings.Index(typeStr, "("); i > 0 && strings.HasSuffix(typeStr, ")") {
+		return strings.TrimSpace(typeStr[:i]), strings.TrimSpace(typeStr[i+1 : len(typeStr)-1])
+	}
+	return typeStr, ""
+}
+
+// baseType returns the type name without arguments, e.g. "timestamp" for "timestamp(us)"
+func baseType(typeStr string) string {
+	name, _ := splitType(typeStr)
+	return name
+}
+
+// isTemporal reports whether the field is a timestamp, date or time column
+func isTemporal(field models.FieldConfig) bool {
+	switch baseType(field.Type) {
+	case "timestamp", "date", "time":
+		return true
+	}
+	return false
+}
+
+// timeUnitOf returns the unit of a timestamp or time column: "timestamp(us)" or unit: us,
+// defaulting to milliseconds
+func timeUnitOf(field models.FieldConfig) string {
+	_, arg := splitType(field.Type)
+	if arg == "" {
+		arg = field.Unit
+	}
+	switch strings.ToLower(arg) {
+	case "us", "micros", "microsecond", "microseconds":
+		return unitMicros
+	case "ns", "nanos", "nanosecond", "nanoseconds":
+		return unitNanos
+	default:
+		return unitMillis
+	}
+}
+
+// isTimeUnit reports whether timeUnitOf understands a unit
+func isTimeUnit(unit string) bool {
+	switch strings.ToLower(unit) {
+	case "ms", "millis", "millisecond", "milliseconds",
+		"us", "micros", "microsecond", "microseconds",
+		"ns", "nanos", "nanosecond", "nanoseconds":
+		return true
+	}
+	return false
+}
+
+// parquetTimeUnit maps a unit to the parquet-go time unit
+func parquetTimeUnit(unit string) parquet.TimeUnit {
+	switch unit {
+	case unitMicros:
+		return parquet.Microsecond
+	case unitNanos:
+		return parquet.Nanosecond
+	default:
+		return parquet.Millisecond
+	}
+}
+
+// locations caches the timezones of temporal fields by name. They are loaded when the config
+// is validated, so converting a value never reads the timezone database.
+var locations sync.Map
+
+// fieldLocation returns the timezone used for layouts without a zone offset (UTC by default)
+func fieldLocation(field models.FieldConfig) (*time.Location, error) {
+	if field.Timezone == "" {
+		return time.UTC, nil
+	}
+	if loc, ok := locations.Load(field.Timezone); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(field.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: unknown timezone %s: %w", field.Name, field.Timezone, err)
+	}
+	locations.Store(field.Timezone, loc)
+	return loc, nil
+}
+
+// convertTemporal parses a JSON value into a time.Time according to the field format.
+// Formats: rfc3339 (default for timestamps), epoch_s, epoch_ms, epoch_us, epoch_ns, or a Go layout
+// such as "2006-01-02 15:04:05". Time columns yield the time of day on 1970-01-01 UTC.
+// A value that cannot be parsed is an error, handled by the table's required_policy.
+func convertTemporal(value interface{}, field models.FieldConfig) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	loc, err := fieldLocation(field)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseTemporal(value, field, loc)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: invalid %s value: %w", field.Name, baseType(field.Type), err)
+	}
+
+	switch baseType(field.Type) {
+	case "date":
+		// keep the calendar date as seen in the configured timezone
+		y, m, d := t.In(loc).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	case "time":
+		if isEpochFormat(field.Format) {
+			return t.UTC(), nil
+		}
+		h, m, s := t.Clock()
+		return time.Date(1970, 1, 1, h, m, s, t.Nanosecond(), time.UTC), nil
+	default:
+		return t.UTC(), nil
+	}
+}
+
+// isEpochFormat reports whether the format reads numbers as epoch offsets
+func isEpochFormat(format string) bool {
+	return strings.HasPrefix(strings.ToLower(format), "epoch")
+}
+
+// parseTemporal parses a string or numeric JSON value
+func parseTemporal(value interface{}, field models.FieldConfig, loc *time.Location) (time.Time, error) {
+	if t, ok := value.(time.Time); ok {
+		// Computed by an expr
+		return t, nil
+	}
+	format := strings.ToLower(strings.TrimSpace(field.Format))
+
+	if isEpochFormat(format) {
+		return parseEpoch(value, format)
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("expected a string for format %q, got %T", field.Format, value)
+	}
+
+	layouts := []string{field.Format}
+	switch format {
+	case "", "rfc3339":
+		switch baseType(field.Type) {
+		case "date":
+			layouts = []string{"2006-01-02", time.RFC3339Nano}
+		case "time":
+			layouts = []string{"15:04:05.999999999", time.RFC3339Nano}
+		default:
+			layouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+		}
+	case "rfc1123":
+		layouts = []string{time.RFC1123, time.RFC1123Z}
+	}
+
+	var lastErr error
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, s, loc)
+		if err == nil {
+			return t, nil
+		}
+		lastErr = err
+	}
+	return time.Time{}, lastErr
+}
+
+// parseEpoch interprets a number (or numeric string) as an offset from the Unix epoch
+func parseEpoch(value interface{}, format string) (time.Time, error) {
+	var n float64
+	var i int64
+	integral := false
+
+	switch v := value.(type) {
+	case float64:
+		// whole numbers take the exact integer path so large epochs don't pick up float error
+		if v == math.Trunc(v) && math.Abs(v) < math.MaxInt64 {
+			i, integral = int64(v), true
+		} else {
+			n = v
+		}
+	case int64:
+		i, integral = v, true
+	case int:
+		i, integral = int64(v), true
+	case json.Number:
+		if parsed, err := v.Int64(); err == nil {
+			i, integral = parsed, true
+		} else if f, err := v.Float64(); err == nil {
+			n = f
+		} else {
+			return time.Time{}, err
+		}
+	case string:
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil {
+			i, integral = parsed, true
+		} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+			n = f
+		} else {
+			return time.Time{}, fmt.Errorf("invalid epoch value %q", v)
+		}
+	default:
+		return time.Time{}, fmt.Errorf("expected an epoch number, got %T", value)
+	}
+
+	scale := int64(time.Second)
+	switch format {
+	case "epoch_ms", "epoch_millis":
+		scale = int64(time.Millisecond)
+	case "epoch_us", "epoch_micros":
+		scale = int64(time.Microsecond)
+	case "epoch_ns", "epoch_nanos":
+		scale = 1
+	}
+
+	if integral {
+		if i > math.MaxInt64/scale || i < math.MinInt64/scale {
+			return time.Time{}, fmt.Errorf("epoch value %d out of range", i)
+		}
+		return time.Unix(0, i*scale).UTC(), nil
+	}
+	return time.Unix(0, int64(n*float64(scale))).UTC(), nil
+}
+
+// temporalToInt converts a time.Time to the physical value of a temporal column:
+// days since the epoch for dates, time of day for times, and the offset since the epoch for timestamps
+func temporalToInt(t time.Time, field models.FieldConfig) int64 {
+	unit := timeUnitOf(field)
+	var d time.Duration
+	switch baseType(field.Type) {
+	case "date":
+		return int64(math.Floor(float64(t.Unix()) / 86400))
+	case "time":
+		h, m, s := t.Clock()
+		d = time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+		switch unit {
+		case unitMicros:
+			return int64(d / time.Microsecond)
+		case unitNanos:
+			return int64(d)
+		default:
+			return int64(d / time.Millisecond)
+		}
+	default:
+		switch unit {
+		case unitMicros:
+			return t.UnixMicro()
+		case unitNanos:
+			return t.UnixNano()
+		default:
+			return t.UnixMilli()
+		}
+	}
+}
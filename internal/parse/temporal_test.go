@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+func TestConvertTemporal(t *testing.T) {
+	tests := []struct {
+		field   models.FieldConfig
+		value   interface{}
+		want    string // RFC 3339 in UTC
+		wantErr string // Substring of the error
+	}{
+		{field: models.FieldConfig{Type: "timestamp"}, value: "2026-10-17T10:20:30+02:00", want: "2026-10-17T08:20:30Z"},
+		{field: models.FieldConfig{Type: "timestamp", Format: "epoch_ms"}, value: json.Number("1792232430123"), want: "2026-10-17T10:20:30.123Z"},
+		{field: models.FieldConfig{Type: "timestamp", Format: "2006-01-02 15:04", Timezone: "Europe/Berlin"}, value: "2026-10-17 10:20", want: "2026-10-17T08:20:00Z"},
+		{field: models.FieldConfig{Type: "date", Timezone: "America/New_York"}, value: "2026-10-17T02:00:00Z", want: "2026-10-16T00:00:00Z"},
+		{field: models.FieldConfig{Type: "time", Format: "15:04"}, value: "07:45", want: "1970-01-01T07:45:00Z"},
+		{field: models.FieldConfig{Type: "timestamp"}, value: nil},
+
+		{field: models.FieldConfig{Type: "timestamp"}, value: "yesterday", wantErr: "field at: invalid timestamp value"},
+		{field: models.FieldConfig{Type: "date"}, value: json.Number("20261017"), wantErr: "expected a string"},
+		{field: models.FieldConfig{Type: "timestamp", Format: "epoch_s"}, value: "soon", wantErr: "invalid epoch value"},
+	}
+	for _, tt := range tests {
+		tt.field.Name = "at"
+		t.Run(tt.field.Type+"/"+tt.field.Format, func(t *testing.T) {
+			got, err := convertField(tt.value, tt.field)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == "" {
+				if got != nil {
+					t.Fatalf("got %v, want nil", got)
+				}
+				return
+			}
+			if s := got.(time.Time).Format(time.RFC3339Nano); s != tt.want {
+				t.Errorf("got %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimezoneLoadedWithConfig(t *testing.T) {
+	locations.Delete("Asia/Tokyo")
+	field := models.FieldConfig{Name: "at", Type: "timestamp", Timezone: "Asia/Tokyo"}
+	if err := validateFieldType(field); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := locations.Load("Asia/Tokyo"); !ok {
+		t.Error("validating the field did not load its timezone")
+	}
+
+	field.Timezone = "Mars/Olympus"
+	if err := validateFieldType(field); err == nil || !strings.Contains(err.Error(), "unknown timezone") {
+		t.Errorf("error = %v, want an unknown timezone", err)
+	}
+}
+
+func TestInvalidTemporalRequiredPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		rows    int
+		skipped int64
+		wantErr bool
+	}{
+		{policy: "fail", wantErr: true},
+		{policy: "skip", rows: 1, skipped: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			gp, rows := newTestParser(t, `
+required_policy: `+tt.policy+`
+tables:
+  - name: events
+    json_path: events
+    fields:
+      - {name: at, json_path: at, type: timestamp}
+`)
+			err := gp.processRecord(decodeRecord(t, `{"events": [{"at": "2026-10-17T10:20:30Z"}, {"at": "not a time"}]}`))
+
+			var convErr *ConversionError
+			if tt.wantErr != errors.As(err, &convErr) {
+				t.Fatalf("processRecord error = %v, want a conversion error: %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && (len(rows["events"]) != tt.rows || gp.skipped["events"] != tt.skipped) {
+				t.Errorf("got %d rows and %d skipped, want %d and %d", len(rows["events"]), gp.skipped["events"], tt.rows, tt.skipped)
+			}
+		})
+	}
+}
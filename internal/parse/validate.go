@@ -0,0 +1,434 @@
+package parse
+
+import (
+	"fmt"
+	"go/token"
+	"os"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/internal/expr"
+	fetchs3 "github.com/kweheliye/json2parquet/internal/fetch/s3"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// ValidateOptions controls ValidateConfigFile
+type ValidateOptions struct {
+	Sample string // Optional JSON or NDJSON file the config is tried on
+	Limit  int    // Root records read from the sample, 0 reads the whole file
+}
+
+// ValidateConfigFile checks a parse config file and returns every problem found, in file order.
+// With a sample, the config is also run on the sample's records (without writing anything) to
+// find tables and fields whose paths never match. The error is only set when the config or
+// the sample cannot be read.
+func ValidateConfigFile(path string, opts ValidateOptions) ([]Diagnostic, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	v := &configValidator{file: path}
+	config := v.decode(data)
+	if config == nil {
+		return v.sorted(), nil
+	}
+	v.checkConfig(config)
+
+	if opts.Sample != "" && !HasErrors(v.diagnostics) {
+		if err := v.checkSample(config, opts); err != nil {
+			return v.sorted(), err
+		}
+	}
+	return v.sorted(), nil
+}
+
+// ValidateParseConfig checks a decoded parse config. Diagnostics name the offending setting
+// by its config path but carry no position.
+func ValidateParseConfig(config *models.ParseConfig) []Diagnostic {
+	v := &configValidator{}
+	v.checkConfig(config)
+	return v.sorted()
+}
+
+// configColumn is a column of a table (or of a struct column) with the config path defining it
+type configColumn struct {
+	name string
+	path string
+}
+
+// checkConfig runs every static check on a config
+func (v *configValidator) checkConfig(config *models.ParseConfig) {
+	v.checkSource(config.Source)
+
+	if config.OutputPath == "" {
+		v.report(SeverityError, "output_path", "output_path is required")
+	} else if fetchs3.IsS3URL(config.OutputPath) {
+		if _, _, err := fetchs3.ParseURL(config.OutputPath); err != nil {
+			v.report(SeverityError, "output_path", "%v", err)
+		}
+	}
+	switch config.Compression {
+	case "", "zstd", "snappy", "gzip", "none":
+	default:
+		v.report(SeverityError, "compression", "unknown compression %q (expected zstd, snappy, gzip or none)", config.Compression)
+	}
+	v.checkRequiredPolicy("required_policy", config.RequiredPolicy)
+	v.checkFilenameTemplate("filename_template", config.FilenameTemplate)
+
+	if len(config.Tables) == 0 {
+		v.report(SeverityError, "tables", "no tables are configured")
+		return
+	}
+	byName := v.checkTableNames(config)
+	for i := range config.Tables {
+		v.checkTable(config, i, byName)
+	}
+	v.checkTableTree(config, byName)
+}
+
+// checkSource checks the source type, path, format and compression
+func (v *configValidator) checkSource(source models.SourceConfig) {
+	switch strings.ToLower(strings.TrimSpace(source.Type)) {
+	case "", "file", "url", "http", "https", "s3":
+	default:
+		v.report(SeverityError, "source.type", "unknown source type %q (expected file, url or s3)", source.Type)
+	}
+	if len(source.Path) == 0 {
+		v.report(SeverityError, "source.path", "path is required")
+	}
+	for i, p := range source.Path {
+		if strings.TrimSpace(p) == "" {
+			v.report(SeverityError, joinConfigIndex("source.path", i), "path is empty")
+		}
+	}
+	if _, err := resolveFormat(source, ""); err != nil {
+		v.report(SeverityError, "source.format", "%v", err)
+	}
+	if _, err := normalizeCompression(source.Compression); err != nil {
+		v.report(SeverityError, "source.compression", "%v", err)
+	}
+}
+
+// checkRequiredPolicy checks a global or per-table required_policy
+func (v *configValidator) checkRequiredPolicy(path, policy string) {
+	switch policy {
+	case "", policyFail, policySkip, policyDeadLetter:
+	default:
+		v.report(SeverityError, path, "unknown required_policy %q (expected fail, skip or dead_letter)", policy)
+	}
+}
+
+// checkFilenameTemplate checks that a template formats exactly one file number
+func (v *configValidator) checkFilenameTemplate(path, template string) {
+	if template != "" && strings.Count(template, "%") != 1 {
+		v.report(SeverityError, path, "filename_template %q must contain exactly one verb for the file number", template)
+	}
+}
+
+// checkTableNames reports missing and duplicate table names and aliases, and returns the
+// index of the table each name or alias refers to
+func (v *configValidator) checkTableNames(config *models.ParseConfig) map[string]int {
+	byName := make(map[string]int)
+	for i, tableConfig := range config.Tables {
+		path := joinConfigIndex("tables", i)
+		if tableConfig.Name == "" {
+			v.report(SeverityError, path, "name is required")
+		}
+		for _, key := range []string{"name", "alias"} {
+			name := tableConfig.Name
+			if key == "alias" {
+				name = tableConfig.Alias
+			}
+			if name == "" {
+				continue
+			}
+			if other, ok := byName[name]; ok {
+				v.report(SeverityError, joinConfigKey(path, key), "%q is already used by table %s (%s)",
+					name, config.Tables[other].Name, joinConfigIndex("tables", other))
+				continue
+			}
+			byName[name] = i
+		}
+	}
+	return byName
+}
+
+// checkTable checks the settings, fields and parent_refs of a table and the names of its columns
+func (v *configValidator) checkTable(config *models.ParseConfig, i int, byName map[string]int) {
+	tableConfig := config.Tables[i]
+	path := joinConfigIndex("tables", i)
+
+	if _, err := compilePath(tableConfig.JSONPath); err != nil {
+		v.report(SeverityError, joinConfigKey(path, "json_path"), "%v", err)
+	}
+	if tableConfig.Parent != "" {
+		if _, ok := byName[tableConfig.Parent]; !ok {
+			v.report(SeverityError, joinConfigKey(path, "parent"), "parent %q does not match a table name or alias", tableConfig.Parent)
+		}
+	}
+	if tableConfig.Where != "" {
+		if _, err := compilePredicate(tableConfig.Where, nil); err != nil {
+			v.report(SeverityError, joinConfigKey(path, "where"), "%v", err)
+		}
+	}
+	v.checkRequiredPolicy(joinConfigKey(path, "required_policy"), tableConfig.RequiredPolicy)
+	v.checkFilenameTemplate(joinConfigKey(path, "filename_template"), tableConfig.FilenameTemplate)
+	if key := tableConfig.SurrogateKey; key != nil {
+		switch key.Strategy {
+		case "", keyRowID, keyUUID7, keyHash:
+		default:
+			v.report(SeverityError, joinConfigKey(path, "surrogate_key.strategy"), "unknown surrogate_key strategy %q (expected row_id, uuid7 or hash)", key.Strategy)
+		}
+	}
+
+	// Columns in schema order: parent_refs, generated key and ordinal, fields, unmapped, provenance
+	var columns []configColumn
+	for j, parentRef := range tableConfig.ParentRefs {
+		refPath := joinConfigIndex(joinConfigKey(path, "parent_refs"), j)
+		if parentRef.EntityName == "" {
+			v.report(SeverityError, refPath, "entity_name is required")
+		} else if _, ok := byName[parentRef.EntityName]; !ok {
+			v.report(SeverityError, joinConfigKey(refPath, "entity_name"), "%q does not match a table name or alias", parentRef.EntityName)
+		}
+		fieldsPath := joinConfigKey(refPath, "fields")
+		parentKey := ""
+		if other, ok := byName[parentRef.EntityName]; ok {
+			parentKey = surrogateKeyName(config.Tables[other])
+		}
+		v.checkFields(fieldsPath, parentRef.Fields, parentKey)
+		columns = append(columns, fieldColumns(fieldsPath, parentRef.Fields)...)
+
+		// The parent's surrogate key is added unless the entry already lists it
+		if other, ok := byName[parentRef.EntityName]; ok && other != i {
+			if keyName := surrogateKeyName(config.Tables[other]); keyName != "" && !isParentKeyField(config.Tables[other], findField(parentRef.Fields, keyName)) {
+				columns = append(columns, configColumn{name: keyName, path: joinConfigKey(refPath, "entity_name")})
+			}
+		}
+	}
+	if keyName := surrogateKeyName(tableConfig); keyName != "" {
+		columns = append(columns, configColumn{name: keyName, path: joinConfigKey(path, "surrogate_key")})
+	}
+	if tableConfig.OrdinalColumn != "" {
+		columns = append(columns, configColumn{name: tableConfig.OrdinalColumn, path: joinConfigKey(path, "ordinal_column")})
+	}
+	fieldsPath := joinConfigKey(path, "fields")
+	v.checkFields(fieldsPath, tableConfig.Fields, "")
+	columns = append(columns, fieldColumns(fieldsPath, tableConfig.Fields)...)
+	if tableConfig.CaptureUnmapped != "" {
+		columns = append(columns, configColumn{name: tableConfig.CaptureUnmapped, path: joinConfigKey(path, "capture_unmapped")})
+	}
+	if config.Source.Provenance.SourceFile {
+		columns = append(columns, configColumn{name: sourceFileColumn, path: "source.provenance.source_file"})
+	}
+	if config.Source.Provenance.RecordIndex {
+		columns = append(columns, configColumn{name: sourceRecordIndexColumn, path: "source.provenance.source_record_index"})
+	}
+
+	if len(columns) == 0 {
+		v.report(SeverityError, path, "table %s has no columns", tableConfig.Name)
+	}
+	v.checkColumnNames(columns)
+
+	names := make(map[string]bool, len(columns))
+	for _, col := range columns {
+		names[col.name] = true
+	}
+	for k, col := range tableConfig.PartitionBy {
+		if !names[col] {
+			v.report(SeverityError, joinConfigIndex(joinConfigKey(path, "partition_by"), k), "partition column %s is not a column of table %s", col, tableConfig.Name)
+		}
+	}
+}
+
+// surrogateKeyName returns the name of a table's surrogate key column, or "" without one
+func surrogateKeyName(tableConfig models.TableConfig) string {
+	switch {
+	case tableConfig.SurrogateKey == nil:
+		return ""
+	case tableConfig.SurrogateKey.Name != "":
+		return tableConfig.SurrogateKey.Name
+	default:
+		return tableConfig.Name + "_key"
+	}
+}
+
+// fieldColumns lists fields as columns located at their names
+func fieldColumns(path string, fields []models.FieldConfig) []configColumn {
+	columns := make([]configColumn, len(fields))
+	for i, field := range fields {
+		columns[i] = configColumn{name: field.Name, path: joinConfigKey(joinConfigIndex(path, i), "name")}
+	}
+	return columns
+}
+
+// checkFields checks the name, json_path and type of fields, recursing into sub-fields.
+// parentKey names the parent's surrogate key in parent_refs fields, the one field that may
+// leave out json_path.
+func (v *configValidator) checkFields(path string, fields []models.FieldConfig, parentKey string) {
+	for i, field := range fields {
+		fieldPath := joinConfigIndex(path, i)
+		if field.Name == "" {
+			v.report(SeverityError, fieldPath, "name is required")
+		}
+		if !hasSource(field) && (parentKey == "" || field.Name != parentKey) {
+			v.report(SeverityError, fieldPath, "field %s has no source: set json_path, json_paths or expr", field.Name)
+		}
+		if _, err := compilePath(field.JSONPath); err != nil {
+			v.report(SeverityError, joinConfigKey(fieldPath, "json_path"), "%v", err)
+		}
+		v.checkJSONPaths(fieldPath, field)
+		typeErr := validateFieldType(field)
+		if typeErr != nil {
+			msg := strings.TrimPrefix(typeErr.Error(), "field "+field.Name+": ")
+			v.report(SeverityError, joinConfigKey(fieldPath, fieldSettingOf(field)), "%s", msg)
+		}
+		if field.Expr != "" {
+			v.checkExpr(fieldPath, field, typeErr == nil)
+		}
+
+		subPath := joinConfigKey(fieldPath, "fields")
+		switch {
+		case hasSubFields(field):
+			v.checkFields(subPath, field.Fields, "")
+			v.checkColumnNames(fieldColumns(subPath, field.Fields))
+			v.checkNoSubFieldExprs(subPath, field.Fields)
+		case len(field.Fields) > 0:
+			v.report(SeverityWarning, subPath, "fields are only used by struct, list<struct> and map<string,struct> columns, not %s", field.Type)
+		}
+	}
+}
+
+// checkJSONPaths compiles the candidate paths of a field
+func (v *configValidator) checkJSONPaths(fieldPath string, field models.FieldConfig) {
+	if len(field.JSONPaths) == 0 {
+		return
+	}
+	pathsPath := joinConfigKey(fieldPath, "json_paths")
+	if field.JSONPath != "" {
+		v.report(SeverityError, pathsPath, "set either json_path or json_paths, not both")
+	}
+	for i, path := range field.JSONPaths {
+		if _, err := compilePath(path); err != nil {
+			v.report(SeverityError, joinConfigIndex(pathsPath, i), "%v", err)
+		}
+	}
+}
+
+// checkExpr compiles the expr of a computed column and checks that its type fits the column
+func (v *configValidator) checkExpr(fieldPath string, field models.FieldConfig, typeOK bool) {
+	exprPath := joinConfigKey(fieldPath, "expr")
+	switch {
+	case field.JSONPath != "":
+		v.report(SeverityError, exprPath, "set either json_path or expr, not both")
+	case len(field.JSONPaths) > 0:
+		v.report(SeverityError, exprPath, "set either json_paths or expr, not both")
+	}
+	if field.CaseInsensitive {
+		v.report(SeverityWarning, joinConfigKey(fieldPath, "case_insensitive"), "case_insensitive only applies to json_path and json_paths, not expr")
+	}
+	e, err := expr.Compile(field.Expr, nil)
+	switch {
+	case err != nil:
+		v.report(SeverityError, exprPath, "%v", err)
+	case typeOK && !exprFitsColumn(e.Type(), field):
+		v.report(SeverityError, exprPath, "expr yields %s, which cannot be written to a %s column", e.Type(), field.Type)
+	}
+}
+
+// checkNoSubFieldExprs reports expr on the sub-fields of nested columns, which only read json_path
+func (v *configValidator) checkNoSubFieldExprs(path string, fields []models.FieldConfig) {
+	for i, field := range fields {
+		if field.Expr != "" {
+			v.report(SeverityError, joinConfigKey(joinConfigIndex(path, i), "expr"), "expr is only supported on top level columns")
+		}
+	}
+}
+
+// fieldSettingOf returns the setting a type error of the field is best reported at
+func fieldSettingOf(field models.FieldConfig) string {
+	isDecimal := baseType(field.Type) == "decimal"
+	if nestedKind(field.Type) != "" {
+		elem := elementField(field)
+		isDecimal = nestedKind(field.Type) != kindStruct && baseType(elem.Type) == "decimal"
+	}
+	switch {
+	case isDecimal && field.OnOverflow != "":
+		if _, err := overflowPolicy(field); err != nil {
+			return "on_overflow"
+		}
+	case field.Timezone != "":
+		if _, err := fieldLocation(field); err != nil {
+			return "timezone"
+		}
+	}
+	if field.Unit != "" && !isTimeUnit(field.Unit) {
+		return "unit"
+	}
+	return "type"
+}
+
+// checkColumnNames reports column names that cannot be used and columns defined twice. Names
+// become struct fields of the row type, so names differing only in case or underscores clash.
+func (v *configValidator) checkColumnNames(columns []configColumn) {
+	seen := make(map[string]configColumn, len(columns))
+	for _, col := range columns {
+		if col.name == "" {
+			continue
+		}
+		exported := toExportedName(col.name)
+		if !token.IsIdentifier(exported) || !token.IsExported(exported) {
+			v.report(SeverityError, col.path, "column name %q must start with a letter and contain only letters, digits and underscores", col.name)
+			continue
+		}
+		other, ok := seen[exported]
+		switch {
+		case !ok:
+			seen[exported] = col
+		case other.name == col.name:
+			v.report(SeverityError, col.path, "column %s is already defined by %s", col.name, other.path)
+		default:
+			v.report(SeverityError, col.path, "column %s clashes with column %s defined by %s (names may not differ only in case or underscores)", col.name, other.name, other.path)
+		}
+	}
+}
+
+// checkTableTree reports parent cycles and parent_refs naming a table that does not enclose
+// the referencing table. It needs valid paths and parents, so it is skipped after such errors.
+func (v *configValidator) checkTableTree(config *models.ParseConfig, byName map[string]int) {
+	tables := make(map[string]models.TableConfig, len(byName))
+	for name, i := range byName {
+		tables[name] = config.Tables[i]
+	}
+	for _, tableConfig := range config.Tables {
+		if _, err := compilePath(tableConfig.JSONPath); err != nil {
+			return
+		}
+		if _, ok := tables[tableConfig.Parent]; tableConfig.Parent != "" && !ok {
+			return
+		}
+	}
+
+	keys := make(map[string]string)
+	cycle := false
+	for i, tableConfig := range config.Tables {
+		if _, err := resolveEntityKey(tableConfig, tables, keys, nil); err != nil {
+			v.report(SeverityError, joinConfigKey(joinConfigIndex("tables", i), "parent"), "parent tables form a cycle")
+			cycle = true
+		}
+	}
+	if cycle {
+		return
+	}
+
+	for i, tableConfig := range config.Tables {
+		for j, parentRef := range tableConfig.ParentRefs {
+			parent, ok := tables[parentRef.EntityName]
+			if !ok || isAncestorKey(keys[parent.Name], keys[tableConfig.Name]) {
+				continue
+			}
+			path := joinConfigIndex(joinConfigKey(joinConfigIndex("tables", i), "parent_refs"), j)
+			v.report(SeverityError, joinConfigKey(path, "entity_name"), "table %s (json_path %q) does not enclose json_path %q",
+				parent.Name, parent.JSONPath, tableConfig.JSONPath)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// maxSampleFailures caps the distinct record failures reported for a sample
+const maxSampleFailures = 10
+
+// sampleColumn is a configured field whose values are counted while trying a sample
+type sampleColumn struct {
+	table string
+	name  string
+	path  string
+}
+
+// checkSample dry-runs a valid config on the first records of a sample file and reports tables
+// that matched no rows, fields that never held a value and records that failed
+func (v *configValidator) checkSample(config *models.ParseConfig, opts ValidateOptions) error {
+	// Fields as configured, before generated columns are injected
+	var columns []sampleColumn
+	for i, tableConfig := range config.Tables {
+		path := joinConfigIndex("tables", i)
+		for j, parentRef := range tableConfig.ParentRefs {
+			refPath := joinConfigKey(joinConfigIndex(joinConfigKey(path, "parent_refs"), j), "fields")
+			columns = append(columns, sampleColumns(tableConfig.Name, refPath, parentRef.Fields)...)
+		}
+		columns = append(columns, sampleColumns(tableConfig.Name, joinConfigKey(path, "fields"), tableConfig.Fields)...)
+	}
+
+	gp, err := newGenericParser(config)
+	if err != nil {
+		return err
+	}
+	plan, err := gp.Plan([]InputFile{{LocalPath: opts.Sample, Origin: opts.Sample}}, PlanOptions{Limit: opts.Limit})
+	if err != nil {
+		return fmt.Errorf("failed to read sample: %w", err)
+	}
+	if plan.Records == 0 {
+		v.report(SeverityWarning, "", "sample %s has no root records", opts.Sample)
+		return nil
+	}
+
+	tables := make(map[string]*TablePlan, len(plan.Tables))
+	for i, table := range plan.Tables {
+		tables[table.Name] = table
+		path := joinConfigIndex("tables", i)
+		switch {
+		case table.Rows == 0 && table.Skipped == 0 && table.Filtered == 0:
+			v.report(SeverityWarning, joinConfigKey(path, "json_path"), "matched no rows in %d sample records", plan.Records)
+		case table.Rows == 0 && table.Skipped == 0:
+			v.report(SeverityWarning, joinConfigKey(path, "where"), "filtered out all %d sample rows of table %s", table.Filtered, table.Name)
+		case table.Skipped > 0:
+			v.report(SeverityWarning, path, "%d of %d sample rows of table %s miss a required field",
+				table.Skipped, table.Skipped+table.Rows, table.Name)
+		}
+	}
+	for _, col := range columns {
+		table := tables[col.table]
+		if table.Rows == 0 {
+			continue
+		}
+		for _, planned := range table.Columns {
+			if planned.Name == col.name && planned.Values == 0 {
+				v.report(SeverityWarning, col.path, "no value in %d sample rows of table %s", table.Rows, col.table)
+			}
+		}
+	}
+	for i, failure := range plan.Failures {
+		if i == maxSampleFailures {
+			v.report(SeverityWarning, "", "%d more kinds of record failures", len(plan.Failures)-i)
+			break
+		}
+		v.report(SeverityWarning, "", "%d sample records failed: %s", failure.Records, failure.Message)
+	}
+	return nil
+}
+
+// sampleColumns lists the fields read from the JSON, located at their json_path or json_paths
+func sampleColumns(table, path string, fields []models.FieldConfig) []sampleColumn {
+	var columns []sampleColumn
+	for i, field := range fields {
+		key := "json_path"
+		switch {
+		case len(field.JSONPaths) > 0:
+			key = "json_paths"
+		case field.JSONPath == "":
+			continue
+		}
+		columns = append(columns, sampleColumn{
+			table: table,
+			name:  field.Name,
+			path:  joinConfigKey(joinConfigIndex(path, i), key),
+		})
+	}
+	return columns
+}
@@ -0,0 +1,344 @@
+package parse
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kweheliye/json2parquet/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Diagnostic severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is a problem found in a parse config. Line and Column locate the YAML node it is
+// about (0 when unknown) and Path names it, e.g. tables[1].fields[0].type.
+type Diagnostic struct {
+	File     string
+	Line     int
+	Column   int
+	Severity string
+	Path     string
+	Message  string
+}
+
+// String formats the diagnostic as file:line:column: severity: path: message
+func (d Diagnostic) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		b.WriteString(d.File)
+		if d.Line > 0 {
+			fmt.Fprintf(&b, ":%d:%d", d.Line, d.Column)
+		}
+		b.WriteString(": ")
+	}
+	b.WriteString(d.Severity + ": ")
+	if d.Path != "" {
+		b.WriteString(d.Path + ": ")
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+// HasErrors reports whether any diagnostic is an error
+func HasErrors(diagnostics []Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// configValidator collects the diagnostics of a parse config. root is the YAML mapping the
+// config was decoded from, nil when the config did not come from YAML.
+type configValidator struct {
+	file        string
+	root        *yaml.Node
+	diagnostics []Diagnostic
+}
+
+// decodeParseConfig decodes and validates a parse config. The config is nil when the YAML
+// could not be decoded at all.
+func decodeParseConfig(file string, data []byte) (*models.ParseConfig, []Diagnostic) {
+	v := &configValidator{file: file}
+	config := v.decode(data)
+	if config != nil {
+		v.checkConfig(config)
+	}
+	return config, v.sorted()
+}
+
+// decode parses the YAML, reporting syntax errors, unknown keys and values of the wrong type
+func (v *configValidator) decode(data []byte) *models.ParseConfig {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		v.reportDecodeError(err.Error())
+		return nil
+	}
+	if len(doc.Content) == 0 {
+		v.report(SeverityError, "", "config is empty")
+		return nil
+	}
+	v.root = doc.Content[0]
+	v.checkKeys(v.root, reflect.TypeOf(models.ParseConfig{}), "")
+
+	var config models.ParseConfig
+	if err := v.root.Decode(&config); err != nil {
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			v.reportDecodeError(err.Error())
+			return nil
+		}
+		// The rest of the config is still decoded
+		for _, msg := range typeErr.Errors {
+			v.reportDecodeError(msg)
+		}
+	}
+	return &config
+}
+
+// decodeErrorLine matches the line number yaml.v3 puts in its error messages
+var decodeErrorLine = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// reportDecodeError reports a yaml.v3 error at the line it names
+func (v *configValidator) reportDecodeError(msg string) {
+	m := decodeErrorLine.FindStringSubmatch(msg)
+	if m == nil {
+		v.report(SeverityError, "", "%s", strings.TrimPrefix(msg, "yaml: "))
+		return
+	}
+	line, _ := strconv.Atoi(m[1])
+	path, node := nodeAtLine(v.root, "", line)
+	d := Diagnostic{File: v.file, Line: line, Severity: SeverityError, Path: path, Message: m[2]}
+	if node != nil {
+		d.Column = node.Column
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+// report adds a diagnostic located at the node of a config path
+func (v *configValidator) report(severity, path, format string, args ...interface{}) {
+	v.reportNode(lookupNode(v.root, path), severity, path, format, args...)
+}
+
+// reportNode adds a diagnostic located at node
+func (v *configValidator) reportNode(node *yaml.Node, severity, path, format string, args ...interface{}) {
+	d := Diagnostic{File: v.file, Severity: severity, Path: path, Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		d.Line, d.Column = node.Line, node.Column
+	}
+	v.diagnostics = append(v.diagnostics, d)
+}
+
+// sorted returns the diagnostics in file order; diagnostics without a position come last
+func (v *configValidator) sorted() []Diagnostic {
+	sort.SliceStable(v.diagnostics, func(i, j int) bool {
+		a, b := v.diagnostics[i], v.diagnostics[j]
+		if (a.Line == 0) != (b.Line == 0) {
+			return b.Line == 0
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return v.diagnostics
+}
+
+// unmarshalerType is implemented by config types decoding themselves, e.g. models.PathList
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// checkKeys reports mapping keys that do not match a yaml tag of the type they decode into
+func (v *configValidator) checkKeys(node *yaml.Node, t reflect.Type, path string) {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(unmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Tag == "!!merge" {
+				v.checkKeys(value, t, path)
+				continue
+			}
+			field, ok := fields[key.Value]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %q", key.Value)
+				if suggestion := closestKey(key.Value, fields); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				v.reportNode(key, SeverityError, path, "%s", msg)
+				continue
+			}
+			v.checkKeys(value, field.Type, joinConfigKey(path, key.Value))
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			v.checkKeys(item, t.Elem(), joinConfigIndex(path, i))
+		}
+	}
+}
+
+// yamlFields indexes the fields of a struct type by their yaml key
+func yamlFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+// closestKey suggests the known key nearest to an unknown one, if any is close enough
+func closestKey(key string, fields map[string]reflect.StructField) string {
+	best, bestDistance := "", len(key)/3+1
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if d := editDistance(strings.ToLower(key), name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// joinConfigKey appends a mapping key to a config path
+func joinConfigKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// joinConfigIndex appends a sequence index to a config path
+func joinConfigIndex(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// lookupNode returns the node of a config path such as tables[1].fields[0].type. When part of
+// the path is missing, the deepest node found is returned, so that a missing key is reported
+// at the mapping that lacks it.
+func lookupNode(root *yaml.Node, path string) *yaml.Node {
+	node := root
+	if node == nil || path == "" {
+		return node
+	}
+	for _, part := range strings.Split(path, ".") {
+		key, rest, _ := strings.Cut(part, "[")
+		if key != "" {
+			next := mappingValue(node, key)
+			if next == nil {
+				return node
+			}
+			node = next
+		}
+		for rest != "" {
+			index, after, _ := strings.Cut(rest, "]")
+			i, err := strconv.Atoi(index)
+			if err != nil || node.Kind != yaml.SequenceNode || i >= len(node.Content) {
+				return node
+			}
+			node = node.Content[i]
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return node
+}
+
+// mappingValue returns the value of a key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// nodeAtLine finds the first value node on a line, with its config path
+func nodeAtLine(node *yaml.Node, path string, line int) (string, *yaml.Node) {
+	if node == nil {
+		return "", nil
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			keyPath := joinConfigKey(path, key.Value)
+			if value.Line == line {
+				return keyPath, value
+			}
+			if p, n := nodeAtLine(value, keyPath, line); n != nil {
+				return p, n
+			}
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			itemPath := joinConfigIndex(path, i)
+			if item.Line == line && item.Kind == yaml.ScalarNode {
+				return itemPath, item
+			}
+			if p, n := nodeAtLine(item, itemPath, line); n != nil {
+				return p, n
+			}
+		}
+	}
+	return "", nil
+}
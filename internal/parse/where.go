@@ -0,0 +1,50 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/kweheliye/json2parquet/internal/expr"
+	"github.com/kweheliye/json2parquet/models"
+)
+
+// compileWhere compiles the where predicate of every table that has one. Leading names that
+// are the name or alias of an ancestor table read from that table's row in the parent context.
+func compileWhere(config *models.ParseConfig, tree *tableTree) (map[string]*expr.Expr, error) {
+	filters := make(map[string]*expr.Expr)
+	for _, tableConfig := range config.Tables {
+		if tableConfig.Where == "" {
+			continue
+		}
+		filter, err := compilePredicate(tableConfig.Where, contextNames(tableConfig, tree))
+		if err != nil {
+			return nil, fmt.Errorf("table %s: where: %w", tableConfig.Name, err)
+		}
+		filters[tableConfig.Name] = filter
+	}
+	return filters, nil
+}
+
+// compilePredicate compiles a where predicate. Predicates are expressions like those of
+// computed columns and must yield a bool.
+func compilePredicate(src string, vars []string) (*expr.Expr, error) {
+	e, err := expr.Compile(src, vars)
+	if err != nil {
+		return nil, err
+	}
+	if t := e.Type(); t != expr.Bool && t != expr.Any && t != expr.Null {
+		return nil, fmt.Errorf("predicate %q yields %s, not bool", src, t)
+	}
+	return e, nil
+}
+
+// contextNames lists the names and aliases of the ancestor tables bound in a table's context
+func contextNames(tableConfig models.TableConfig, tree *tableTree) []string {
+	key := tree.keys[tableConfig.Name]
+	var vars []string
+	for name, other := range tree.byName {
+		if other.Name != tableConfig.Name && isAncestorKey(tree.keys[other.Name], key) {
+			vars = append(vars, name)
+		}
+	}
+	return vars
+}
@@ -0,0 +1,91 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// whereRecord holds two projects with a task each
+const whereRecord = `{"batch": 2, "projects": [
+	{"id": 1, "status": "open", "owner": "ana", "tasks": [{"title": "a", "done": false, "n": 12345678901234567890}]},
+	{"id": 2, "status": "archived", "owner": "li", "tasks": [{"title": "b", "done": true, "tags": ["x"]}]}
+]}`
+
+func TestWhere(t *testing.T) {
+	tests := []struct {
+		where string
+		tasks string // Titles of the tasks written
+	}{
+		{where: "done == false", tasks: "a"},
+		{where: "!done", tasks: "a"},
+		{where: "project.status != 'archived' && $.batch > 1", tasks: "a"},
+		{where: "project.owner in ['ana', 'li'] and title =~ /^B$/i", tasks: "b"},
+		{where: "n == 12345678901234567890", tasks: "a"},
+		{where: "n == 12345678901234567891", tasks: ""},
+		{where: "tags is null", tasks: "a"},
+		{where: "length(coalesce(tags, '')) > 0", tasks: "b"},
+		{where: "upper(title) not in ('A')", tasks: "b"},
+		{where: "project.missing", tasks: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			gp, rows := newTestParser(t, `
+tables:
+  - name: projects
+    alias: project
+    json_path: projects
+    fields:
+      - {name: id, json_path: id, type: int64}
+  - name: tasks
+    parent: projects
+    json_path: tasks
+    where: "`+tt.where+`"
+    fields:
+      - {name: title, json_path: title, type: string}
+`)
+			if err := gp.processRecord(decodeRecord(t, whereRecord)); err != nil {
+				t.Fatalf("processRecord: %v", err)
+			}
+			var titles []string
+			for _, row := range rows["tasks"] {
+				titles = append(titles, row["title"].(string))
+			}
+			if got := strings.Join(titles, ","); got != tt.tasks {
+				t.Errorf("tasks = %q, want %q", got, tt.tasks)
+			}
+		})
+	}
+}
+
+func TestWhereErrors(t *testing.T) {
+	tests := []struct {
+		where string
+		err   string // Substring of the compile error
+	}{
+		{where: "status ==", err: "expected an operand"},
+		{where: "status = 'open'", err: "use == to compare"},
+		{where: "id + 1", err: "yields number, not bool"},
+		{where: "status =~ /(/", err: "invalid regular expression"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.where, func(t *testing.T) {
+			if _, err := compilePredicate(tt.where, nil); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("compilePredicate error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// A value that is not a bool fails the run rather than silently matching
+	gp, _ := newTestParser(t, `
+tables:
+  - name: projects
+    json_path: projects
+    where: "owner"
+    fields:
+      - {name: id, json_path: id, type: int64}
+`)
+	err := gp.processRecord(decodeRecord(t, whereRecord))
+	if err == nil || !strings.Contains(err.Error(), `table projects: where: owner: expected a bool, got string "ana"`) {
+		t.Errorf("processRecord error = %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package parse
+
+import (
+	"strings"
+
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/segmentio/parquet-go"
+	"github.com/spf13/viper"
+)
+
+// WriterOptions holds writer settings resolved from the global and per-table configuration
+type WriterOptions struct {
+	Compression       string // zstd, snappy, gzip or none
+	MaxRowsPerGroup   int64  // Flush a row group after this many rows (0 = no limit)
+	MaxBytesPerGroup  int64  // Flush a row group once its estimated uncompressed size reaches this (0 = no limit)
+	MaxRowsPerFile    int64  // Roll to a new file after this many rows (0 = no limit)
+	MaxBytesPerFile   int64  // Roll to a new file once this many bytes were written (0 = no limit)
+	FilenameTemplate  string // Suffix appended to the table name, formatted with the file number; {codec} is replaced by codecSuffix
+	NumberFiles       bool   // Always name files with the template, even without rolling limits
+	FirstFileIndex    int    // Number of the first file written
+	MaxOpenPartitions int    // Maximum partition writers kept open at once (partitioned tables only)
+}
+
+// defaultFilenameTemplate names rolled files when no template is configured
+const defaultFilenameTemplate = "_%04d.parquet"
+
+// codecPlaceholder in a filename template is replaced with the extension of the output compression
+const codecPlaceholder = "{codec}"
+
+// defaultMaxOpenPartitions caps open partition writers when no limit is configured
+const defaultMaxOpenPartitions = 64
+
+// numbered reports whether file names use the template, which is the case when files roll over
+func (o WriterOptions) numbered() bool {
+	return o.NumberFiles || o.MaxRowsPerFile > 0 || o.MaxBytesPerFile > 0
+}
+
+// resolveWriterOptions applies per-table overrides on top of the parse config,
+// falling back to the writer section of the application config
+func resolveWriterOptions(config *models.ParseConfig, table models.TableConfig) WriterOptions {
+	opts := WriterOptions{
+		Compression:       config.Compression,
+		MaxRowsPerGroup:   int64(config.RowGroup),
+		MaxBytesPerGroup:  config.RowGroupBytes,
+		MaxRowsPerFile:    config.MaxRowsPerFile,
+		MaxBytesPerFile:   config.MaxBytesPerFile,
+		FilenameTemplate:  config.FilenameTemplate,
+		MaxOpenPartitions: config.MaxOpenPartitions,
+	}
+
+	if opts.MaxRowsPerGroup <= 0 && viper.IsSet("writer.max_rows_per_group") {
+		opts.MaxRowsPerGroup = viper.GetInt64("writer.max_rows_per_group")
+	}
+	if opts.MaxRowsPerFile <= 0 && viper.IsSet("writer.max_rows_per_file") {
+		opts.MaxRowsPerFile = viper.GetInt64("writer.max_rows_per_file")
+	}
+	if opts.FilenameTemplate == "" && viper.IsSet("writer.filename_template") {
+		opts.FilenameTemplate = viper.GetString("writer.filename_template")
+	}
+	if table.RowGroup > 0 {
+		opts.MaxRowsPerGroup = int64(table.RowGroup)
+	}
+	if table.RowGroupBytes > 0 {
+		opts.MaxBytesPerGroup = table.RowGroupBytes
+	}
+	if table.MaxRowsPerFile > 0 {
+		opts.MaxRowsPerFile = table.MaxRowsPerFile
+	}
+	if table.MaxBytesPerFile > 0 {
+		opts.MaxBytesPerFile = table.MaxBytesPerFile
+	}
+	if table.FilenameTemplate != "" {
+		opts.FilenameTemplate = table.FilenameTemplate
+	}
+	if opts.FilenameTemplate == "" {
+		opts.FilenameTemplate = defaultFilenameTemplate
+	}
+	opts.FilenameTemplate = strings.ReplaceAll(opts.FilenameTemplate, codecPlaceholder, codecSuffix(opts.Compression))
+	if table.MaxOpenPartitions > 0 {
+		opts.MaxOpenPartitions = table.MaxOpenPartitions
+	}
+	if opts.MaxOpenPartitions <= 0 {
+		opts.MaxOpenPartitions = defaultMaxOpenPartitions
+	}
+
+	return opts
+}
+
+// codecSuffix returns the file name extension of an output compression, empty when uncompressed
+func codecSuffix(compression string) string {
+	switch compression {
+	case "zstd":
+		return ".zstd"
+	case "snappy":
+		return ".snappy"
+	case "gzip":
+		return ".gz"
+	default:
+		return ""
+	}
+}
+
+// estimatedSize returns the uncompressed size of a value, used to size row groups by bytes
+func estimatedSize(v parquet.Value) int64 {
+	switch v.Kind() {
+	case parquet.Boolean:
+		return 1
+	case parquet.Int32, parquet.Float:
+		return 4
+	case parquet.Int64, parquet.Double:
+		return 8
+	case parquet.Int96:
+		return 12
+	default:
+		return int64(len(v.ByteArray()))
+	}
+}
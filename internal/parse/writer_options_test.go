@@ -0,0 +1,83 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/kweheliye/json2parquet/models"
+	"github.com/spf13/viper"
+)
+
+func TestResolveWriterOptionsFileNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		writer   map[string]interface{} // writer section of the application config
+		config   models.ParseConfig
+		table    models.TableConfig
+		numbered bool
+		file     string
+	}{
+		{name: "no limits", config: models.ParseConfig{Compression: "zstd"}, file: "users.parquet"},
+		{
+			name:     "writer section alone",
+			writer:   map[string]interface{}{"max_rows_per_file": 100_000_000, "filename_template": "_%04d.zstd.parquet"},
+			config:   models.ParseConfig{Compression: "zstd"},
+			numbered: true,
+			file:     "users_0000.zstd.parquet",
+		},
+		{
+			name:     "writer limit, default template",
+			writer:   map[string]interface{}{"max_rows_per_file": 10},
+			config:   models.ParseConfig{Compression: "zstd"},
+			numbered: true,
+			file:     "users_0000.parquet",
+		},
+		{name: "codec placeholder", config: models.ParseConfig{Compression: "snappy", MaxRowsPerFile: 10, FilenameTemplate: "_%04d{codec}.parquet"}, numbered: true, file: "users_0000.snappy.parquet"},
+		{name: "uncompressed", config: models.ParseConfig{Compression: "none", MaxRowsPerFile: 10, FilenameTemplate: "_%04d{codec}.parquet"}, numbered: true, file: "users_0000.parquet"},
+		{
+			name:     "table overrides",
+			writer:   map[string]interface{}{"filename_template": "_%04d.zstd.parquet"},
+			config:   models.ParseConfig{Compression: "gzip"},
+			table:    models.TableConfig{MaxBytesPerFile: 1 << 20, FilenameTemplate: "-%d{codec}.parquet"},
+			numbered: true,
+			file:     "users-0.gz.parquet",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Reset()
+			defer viper.Reset()
+			for key, value := range tt.writer {
+				viper.Set("writer."+key, value)
+			}
+
+			opts := resolveWriterOptions(&tt.config, tt.table)
+			if opts.numbered() != tt.numbered {
+				t.Errorf("numbered() = %t, want %t", opts.numbered(), tt.numbered)
+			}
+			dw := &DynamicWriter{baseName: "users", options: opts}
+			if got := dw.fileName(0); got != tt.file {
+				t.Errorf("fileName(0) = %s, want %s", got, tt.file)
+			}
+		})
+	}
+}
+
+func TestPartitionFileNames(t *testing.T) {
+	viper.Set("writer.filename_template", "_%04d.zstd.parquet")
+	defer viper.Reset()
+
+	config := &models.ParseConfig{Compression: "snappy", MaxRowsPerFile: 10}
+	table := models.TableConfig{
+		Name:        "t",
+		PartitionBy: []string{"k"},
+		Fields:      []models.FieldConfig{{Name: "k", Type: "string"}, {Name: "n", Type: "int64"}},
+	}
+	pw, err := NewPartitionedWriter(&localStore{dir: t.TempDir()}, table, resolveWriterOptions(config, table))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dw := &DynamicWriter{baseName: "t/k=a/part", options: pw.options}
+	if got := dw.fileName(1); got != "t/k=a/part-0001.parquet" {
+		t.Errorf("fileName(1) = %s, want t/k=a/part-0001.parquet", got)
+	}
+}
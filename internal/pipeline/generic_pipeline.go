@@ -1,9 +1,9 @@
 package pipeline
 
 import (
+	"fmt"
+	"io"
 	"os"
-	"path/filepath"
-	"strings"
 
 	"github.com/kweheliye/json2parquet/internal/parse"
 	"github.com/kweheliye/json2parquet/models"
@@ -15,6 +15,40 @@ var log = utils.GetLogger()
 
 // NewGenericParsePipeline constructs a Downloader → Parse → Clean pipeline for the generic parser
 func NewGenericParsePipeline(configPath string) (*Pipeline, error) {
+	return newGenericPipeline(configPath, func(gp *parse.GenericParser, dl *GenericDownloadStep) Step {
+		return &GenericParseStep{
+			Parser:     gp,
+			Downloader: dl,
+		}
+	})
+}
+
+// NewGenericPlanPipeline constructs a Downloader → Plan → Clean pipeline that previews what the
+// generic parser would write, in format "table" or "json", without writing Parquet
+func NewGenericPlanPipeline(configPath string, opts parse.PlanOptions, format string, out io.Writer) (*Pipeline, error) {
+	if format != planFormatTable && format != planFormatJSON {
+		return nil, fmt.Errorf("unknown plan format %q (expected table or json)", format)
+	}
+	return newGenericPipeline(configPath, func(gp *parse.GenericParser, dl *GenericDownloadStep) Step {
+		return &GenericPlanStep{
+			Parser:     gp,
+			Downloader: dl,
+			Options:    opts,
+			Format:     format,
+			Out:        out,
+		}
+	})
+}
+
+// newGenericPipeline constructs a Downloader → step → Clean pipeline around a generic parser
+func newGenericPipeline(configPath string, step func(gp *parse.GenericParser, dl *GenericDownloadStep) Step) (*Pipeline, error) {
+	// Instantiate parser from configPath first: it reads the full config including output
+	// settings and rejects invalid configs with every problem found
+	gp, err := parse.NewGenericParser(configPath)
+	if err != nil {
+		return nil, err
+	}
+
 	// Load config to know source and output
 	cfgData, err := os.ReadFile(configPath)
 	if err != nil {
@@ -31,31 +65,13 @@ func NewGenericParsePipeline(configPath string) (*Pipeline, error) {
 		return nil, err
 	}
 
-	// Instantiate parser from configPath (it reads full config including output settings)
-	gp, err := parse.NewGenericParser(configPath)
-	if err != nil {
-		return nil, err
-	}
-
-	// Compute destination file name inside tmp/src
-	base := filepath.Base(cfg.Source.Path)
-	if i := strings.Index(base, "?"); i >= 0 {
-		base = base[:i]
-	}
-	localPath := filepath.Join(tmpDir, "src", base)
-
 	dl := &GenericDownloadStep{
-		Source: parseSource{Type: cfg.Source.Type, Path: cfg.Source.Path},
+		Source: parseSource{Type: cfg.Source.Type, Paths: cfg.Source.Path, S3: cfg.Source.S3},
 		TmpDir: tmpDir,
 	}
 
-	ps := &GenericParseStep{
-		Parser:         gp,
-		InputLocalPath: localPath,
-	}
-
 	clean := &CleanStep{TmpPath: tmpDir}
 
-	steps := []Step{dl, ps, clean}
+	steps := []Step{dl, step(gp, dl), clean}
 	return New(steps...), nil
 }
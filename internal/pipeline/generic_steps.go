@@ -1,6 +1,8 @@
 package pipeline
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net/url"
 	"os"
@@ -10,26 +12,31 @@ import (
 
 	"github.com/kweheliye/json2parquet/internal/fetch"
 	fetchhttp "github.com/kweheliye/json2parquet/internal/fetch/http"
+	fetchs3 "github.com/kweheliye/json2parquet/internal/fetch/s3"
 	"github.com/kweheliye/json2parquet/internal/parse"
+	"github.com/kweheliye/json2parquet/models"
 )
 
-// GenericDownloadStep downloads or copies the source into tmp/src and exposes the local path
+// GenericDownloadStep downloads or copies the sources into tmp/src and exposes the local paths
 // Name: Downloader
 // Behavior:
+// - Source paths are expanded first: local globs and directories become the files they match
+// - If Source.Type is s3 or the path has s3 scheme → S3 ranged multipart download
 // - If Source.Type is http/https/url or the path has http/https scheme → HTTP download
 // - If Source.Type is file or empty → copy local file to tmp/src
 // - Creates tmp/src directory if missing
-// OutputLocalPath is the resulting local file path to be used by the parser step
+// OutputFiles lists the resulting local files, with their origin, to be used by the parser step
 
 type GenericDownloadStep struct {
-	Source          parseSource
-	TmpDir          string
-	OutputLocalPath string
+	Source      parseSource
+	TmpDir      string
+	OutputFiles []parse.InputFile
 }
 
 type parseSource struct {
-	Type string
-	Path string
+	Type  string
+	Paths []string
+	S3    models.S3Config
 }
 
 func (s *GenericDownloadStep) Name() string { return "Downloader" }
@@ -42,50 +49,90 @@ func (s *GenericDownloadStep) Run() {
 		log.Fatalf("failed to create tmp src dir: %v", err)
 	}
 
-	base := filepath.Base(s.Source.Path)
-	// strip query if any
-	if i := strings.Index(base, "?"); i >= 0 {
-		base = base[:i]
+	paths, err := parse.ExpandSourcePaths(s.Source.Paths)
+	if err != nil {
+		log.Fatalf("failed to resolve source paths: %v", err)
 	}
+	log.Infof("[Downloader] Resolved %d source file(s)", len(paths))
 
-	s.OutputLocalPath = filepath.Join(dstDir, base)
-	log.Infof("[Downloader] Resolving source: %s → %s", s.Source.Path, s.OutputLocalPath)
+	var s3Fetcher *fetchs3.S3Fetcher
 
-	// Decide download vs copy
-	if isHTTPSource(s.Source) {
-		cfg := fetch.DefaultFetchConfig()
-		// be a little more generous by default here
-		cfg.Timeout = 2 * time.Minute
-		cfg.MaxRetries = 5
-		dl := fetchhttp.NewHTTPFetcher(cfg)
-		rc, err := dl.FetchReader(s.Source.Path)
-		if err != nil {
-			log.Fatalf("failed to download source: %v", err)
+	s.OutputFiles = make([]parse.InputFile, 0, len(paths))
+	for i, src := range paths {
+		base := localBaseName(src)
+		// keep shards with the same base name from different directories apart
+		if len(paths) > 1 {
+			base = fmt.Sprintf("%04d_%s", i, base)
 		}
-		defer rc.Close()
-		f, err := os.Create(s.OutputLocalPath)
-		if err != nil {
-			log.Fatalf("failed to create tmp file: %v", err)
-		}
-		if _, err := io.Copy(f, rc); err != nil {
-			f.Close()
-			log.Fatalf("failed to save downloaded content: %v", err)
-		}
-		if err := f.Close(); err != nil {
-			log.Fatalf("failed to close tmp file: %v", err)
+		dst := filepath.Join(dstDir, base)
+		log.Infof("[Downloader] Resolving source: %s → %s", src, dst)
+
+		// Decide download vs copy; compressed content is kept compressed and decoded while parsing
+		encoding := ""
+		if isS3Source(s.Source.Type, src) {
+			if s3Fetcher == nil {
+				s3Fetcher = newS3Fetcher(s.Source.S3)
+			}
+			encoding, err = s3Fetcher.FetchToFile(src, dst)
+			if err != nil {
+				log.Fatalf("failed to download source: %v", err)
+			}
+			log.Infof("[Downloader] Downloaded %s (%s)", src, dst)
+		} else if isHTTPSource(s.Source.Type, src) {
+			encoding = downloadHTTP(src, dst)
+		} else {
+			copyLocal(src, dst)
 		}
-		log.Infof("[Downloader] Downloaded %s (%s)", s.Source.Path, s.OutputLocalPath)
-		return
+
+		s.OutputFiles = append(s.OutputFiles, parse.InputFile{LocalPath: dst, Origin: src, ContentEncoding: encoding})
+	}
+}
+
+// localBaseName returns the base name of a source path or URL without any query string
+func localBaseName(src string) string {
+	base := filepath.Base(src)
+	// strip query if any
+	if i := strings.Index(base, "?"); i >= 0 {
+		base = base[:i]
 	}
+	return base
+}
 
-	// Treat as local file
-	src := s.Source.Path
+// downloadHTTP fetches the URL into the destination file and returns its Content-Encoding
+func downloadHTTP(src, dst string) string {
+	cfg := fetch.DefaultFetchConfig()
+	// be a little more generous by default here
+	cfg.Timeout = 2 * time.Minute
+	cfg.MaxRetries = 5
+	dl := fetchhttp.NewHTTPFetcher(cfg)
+	rc, encoding, err := dl.FetchReaderWithEncoding(src)
+	if err != nil {
+		log.Fatalf("failed to download source: %v", err)
+	}
+	defer rc.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		log.Fatalf("failed to create tmp file: %v", err)
+	}
+	if _, err := io.Copy(f, rc); err != nil {
+		f.Close()
+		log.Fatalf("failed to save downloaded content: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("failed to close tmp file: %v", err)
+	}
+	log.Infof("[Downloader] Downloaded %s (%s)", src, dst)
+	return encoding
+}
+
+// copyLocal copies a local source file into the destination file
+func copyLocal(src, dst string) {
 	in, err := os.Open(src)
 	if err != nil {
 		log.Fatalf("failed to open source file: %v", err)
 	}
 	defer in.Close()
-	out, err := os.Create(s.OutputLocalPath)
+	out, err := os.Create(dst)
 	if err != nil {
 		log.Fatalf("failed to create destination file: %v", err)
 	}
@@ -96,19 +143,41 @@ func (s *GenericDownloadStep) Run() {
 	if err := out.Close(); err != nil {
 		log.Fatalf("failed to close destination file: %v", err)
 	}
-	log.Infof("[Downloader] Copied local file %s → %s", src, s.OutputLocalPath)
+	log.Infof("[Downloader] Copied local file %s → %s", src, dst)
+}
+
+// newS3Fetcher builds an S3 fetcher from the source S3 settings
+func newS3Fetcher(s3cfg models.S3Config) *fetchs3.S3Fetcher {
+	awsCfg, err := fetchs3.NewAWSConfig(context.Background(), s3cfg)
+	if err != nil {
+		log.Fatalf("failed to configure S3: %v", err)
+	}
+	cfg := fetch.DefaultFetchConfig()
+	cfg.MaxRetries = 5
+	cfg.AWSConfig = awsCfg
+	cfg.S3UsePathStyle = s3cfg.ForcePathStyle
+	f, err := fetchs3.NewS3Fetcher(cfg)
+	if err != nil {
+		log.Fatalf("failed to create S3 fetcher: %v", err)
+	}
+	return f
+}
+
+// isS3Source determines if the source should be fetched from S3
+func isS3Source(srcType, path string) bool {
+	return strings.EqualFold(strings.TrimSpace(srcType), "s3") || fetchs3.IsS3URL(path)
 }
 
 // isHTTPSource determines if the source should be fetched via HTTP(S)
-func isHTTPSource(src parseSource) bool {
+func isHTTPSource(srcType, path string) bool {
 	// Check explicit type first
-	t := strings.ToLower(strings.TrimSpace(src.Type))
+	t := strings.ToLower(strings.TrimSpace(srcType))
 	switch t {
 	case "http", "https", "url":
 		return true
 	}
 	// Fallback to detecting from URL scheme in the path
-	if u, err := url.Parse(src.Path); err == nil && u != nil {
+	if u, err := url.Parse(path); err == nil && u != nil {
 		scheme := strings.ToLower(u.Scheme)
 		if scheme == "http" || scheme == "https" {
 			return true
@@ -117,12 +186,12 @@ func isHTTPSource(src parseSource) bool {
 	return false
 }
 
-// GenericParseStep runs the generic parser using a provided local input path
+// GenericParseStep runs the generic parser over the local files produced by the Downloader
 // Name: Parse
 
 type GenericParseStep struct {
-	Parser         *parse.GenericParser
-	InputLocalPath string
+	Parser     *parse.GenericParser
+	Downloader *GenericDownloadStep
 }
 
 func (s *GenericParseStep) Name() string {
@@ -133,16 +202,65 @@ func (s *GenericParseStep) Run() {
 	if s.Parser == nil {
 		log.Fatalf("parser is nil in GenericParseStep")
 	}
-	if s.InputLocalPath == "" {
-		log.Fatalf("input path is empty in GenericParseStep")
+	if s.Downloader == nil || len(s.Downloader.OutputFiles) == 0 {
+		log.Fatalf("no input files in GenericParseStep")
 	}
-	log.Infof("[Parse] Parsing JSON from %s", s.InputLocalPath)
-	if err := s.Parser.ParseFile(s.InputLocalPath); err != nil {
+	log.Infof("[Parse] Parsing JSON from %d file(s)", len(s.Downloader.OutputFiles))
+	if err := s.Parser.ParseFiles(s.Downloader.OutputFiles); err != nil {
 		log.Fatalf("failed to parse file: %v", err)
 	}
+	for table, files := range s.Parser.OutputFiles() {
+		log.Infof("[Parse] Table %s: %d file(s)", table, len(files))
+	}
 	log.Infof("[Parse] Completed parsing")
 }
 
+// Output formats of the plan step
+const (
+	planFormatTable = "table"
+	planFormatJSON  = "json"
+)
+
+// GenericPlanStep dry-runs the generic parser over the first records of the downloaded files
+// and writes the resulting plan instead of Parquet files
+// Name: Plan
+
+type GenericPlanStep struct {
+	Parser     *parse.GenericParser
+	Downloader *GenericDownloadStep
+	Options    parse.PlanOptions
+	Format     string // table or json
+	Out        io.Writer
+}
+
+func (s *GenericPlanStep) Name() string {
+	return "Plan"
+}
+
+func (s *GenericPlanStep) Run() {
+	if s.Parser == nil {
+		log.Fatalf("parser is nil in GenericPlanStep")
+	}
+	if s.Downloader == nil || len(s.Downloader.OutputFiles) == 0 {
+		log.Fatalf("no input files in GenericPlanStep")
+	}
+	log.Infof("[Plan] Dry run over %d file(s)", len(s.Downloader.OutputFiles))
+	plan, err := s.Parser.Plan(s.Downloader.OutputFiles, s.Options)
+	if err != nil {
+		log.Fatalf("failed to plan: %v", err)
+	}
+
+	if s.Format == planFormatJSON {
+		err = plan.WriteJSON(s.Out)
+	} else {
+		err = plan.WriteText(s.Out)
+	}
+	if err != nil {
+		log.Fatalf("failed to write plan: %v", err)
+	}
+	log.Infof("[Plan] Completed dry run over %d root records", plan.Records)
+}
+
 // CleanStep removes the temporary working directory
 // Name: Clean
 
@@ -1,47 +1,139 @@
 package models
 
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
 // GenericRecord represents a generic flattened record
 // that can be dynamically created based on configuration
 type GenericRecord map[string]interface{}
 
 // TableConfig defines how to extract and flatten data from nested JSON
 type TableConfig struct {
-	Name        string        `yaml:"name"`        // Table name (e.g., "projects", "tasks")
-	Description string        `yaml:"description"` // Table description
-	JSONPath    string        `yaml:"json_path"`   // Path to the array in JSON (e.g., "projects", "projects[*].tasks")
-	Fields      []FieldConfig `yaml:"fields"`      // Field mappings
-	ParentRefs  []ParentRef   `yaml:"parent_refs"` // References to parent entities
+	Name              string        `yaml:"name"`                // Table name (e.g., "projects", "tasks")
+	Description       string        `yaml:"description"`         // Table description
+	Alias             string        `yaml:"alias"`               // Optional second name for parent_refs of descendant tables (e.g., "user")
+	Parent            string        `yaml:"parent"`              // Optional parent table (name or alias); json_path is then relative to its rows
+	JSONPath          string        `yaml:"json_path"`           // Path to the array in JSON (e.g., "projects", "projects[*].tasks")
+	Fields            []FieldConfig `yaml:"fields"`              // Field mappings
+	ParentRefs        []ParentRef   `yaml:"parent_refs"`         // References to parent entities
+	RowGroup          int           `yaml:"row_group"`           // Rows per group, overrides the global setting
+	RowGroupBytes     int64         `yaml:"row_group_bytes"`     // Target uncompressed bytes per group, overrides the global setting
+	MaxRowsPerFile    int64         `yaml:"max_rows_per_file"`   // Roll to a new file after N rows, overrides the global setting
+	MaxBytesPerFile   int64         `yaml:"max_bytes_per_file"`  // Roll to a new file after N bytes, overrides the global setting
+	FilenameTemplate  string        `yaml:"filename_template"`   // File name suffix template, overrides the global setting
+	PartitionBy       []string      `yaml:"partition_by"`        // Columns for Hive-style partition directories (col=value/...)
+	MaxOpenPartitions int           `yaml:"max_open_partitions"` // Cap on open partition writers, overrides the global setting
+	RequiredPolicy    string        `yaml:"required_policy"`     // Rows missing a required field: fail, skip, dead_letter; overrides the global setting
+	CaptureUnmapped   string        `yaml:"capture_unmapped"`    // json column collecting the keys not read by fields or child tables
+	SurrogateKey      *SurrogateKey `yaml:"surrogate_key"`       // Optional synthetic key column, copied into child tables through parent_refs
+	OrdinalColumn     string        `yaml:"ordinal_column"`      // Optional column holding each row's position in its JSON array
+	Where             string        `yaml:"where"`               // Optional row filter, e.g. "status != 'archived' && user.active == true"
+	Provenance        []FieldConfig `yaml:"-"`                   // Provenance columns injected from the source config
 }
 
 // FieldConfig defines how to map a JSON field to a Parquet column
 type FieldConfig struct {
-	Name         string `yaml:"name"`           // Parquet column name
-	JSONPath     string `yaml:"json_path"`      // Path in JSON (e.g., "project_id", "title")
-	Type         string `yaml:"type"`           // Data type: string, int64, float64, bool
-	ParquetType  string `yaml:"parquet_type"`   // Parquet encoding: plain, enum, etc.
-	Required     bool   `yaml:"required"`       // Is this field required?
-	DefaultValue string `yaml:"default_value"`  // Default value if missing
+	Name            string        `yaml:"name"`             // Parquet column name
+	JSONPath        string        `yaml:"json_path"`        // Path in JSON (e.g., "project_id", "title")
+	JSONPaths       []string      `yaml:"json_paths"`       // Candidate paths instead of json_path, tried in order; the first non-null value wins
+	CaseInsensitive bool          `yaml:"case_insensitive"` // Match member names in json_path(s) ignoring case
+	Expr            string        `yaml:"expr"`             // Computed value instead of json_path, e.g. "concat(first, ' ', last)"
+	Type            string        `yaml:"type"`             // Data type: string, int64, int32, int16, int8, uint64, float64, bool, timestamp, date, time, decimal(p,s), list<T>, map<string,T>, struct, json
+	ParquetType     string        `yaml:"parquet_type"`     // Parquet encoding: plain, enum, etc.
+	Required        bool          `yaml:"required"`         // Reject rows missing this field (per required_policy); the column is not nullable
+	DefaultValue    string        `yaml:"default_value"`    // Default value if missing
+	Format          string        `yaml:"format"`           // timestamp/date/time input format: rfc3339, epoch_s, epoch_ms, epoch_us, epoch_ns or a Go layout
+	Unit            string        `yaml:"unit"`             // timestamp/time unit: ms, us, ns (default ms)
+	Timezone        string        `yaml:"timezone"`         // Zone for layouts without an offset, e.g. "Europe/Berlin" (default UTC)
+	OnOverflow      string        `yaml:"on_overflow"`      // decimal values exceeding the precision: error (default), null, clamp
+	Fields          []FieldConfig `yaml:"fields"`           // Sub-fields of struct, list<struct> and map<string,struct> columns
+}
+
+// SurrogateKey configures a synthetic key column for tables without a natural ID
+type SurrogateKey struct {
+	Name     string `yaml:"name"`     // Column name, defaults to "<table>_key"
+	Strategy string `yaml:"strategy"` // row_id (default), uuid7 or hash
 }
 
 // ParentRef defines a reference to a parent entity
 type ParentRef struct {
-	EntityName string        `yaml:"entity_name"` // Name of parent entity (e.g., "user", "project")
+	EntityName string        `yaml:"entity_name"` // Name or alias of an ancestor table (e.g., "users", "projects")
 	Fields     []FieldConfig `yaml:"fields"`      // Fields to copy from parent
 }
 
 // ParseConfig defines the overall parsing configuration
 type ParseConfig struct {
-	Source      SourceConfig  `yaml:"source"`       // Source data configuration
-	Tables      []TableConfig `yaml:"tables"`       // Table definitions
-	OutputPath  string        `yaml:"output_path"`  // Output directory for Parquet files
-	Compression string        `yaml:"compression"`  // Compression type: zstd, snappy, gzip, none
-	RowGroup    int           `yaml:"row_group"`    // Rows per group
+	Source            SourceConfig  `yaml:"source"`              // Source data configuration
+	Tables            []TableConfig `yaml:"tables"`              // Table definitions
+	OutputPath        string        `yaml:"output_path"`         // Output directory for Parquet files, or s3://bucket/prefix/
+	OutputS3          S3Config      `yaml:"output_s3"`           // Connection settings when output_path is an s3:// URL
+	Compression       string        `yaml:"compression"`         // Compression type: zstd, snappy, gzip, none
+	RowGroup          int           `yaml:"row_group"`           // Rows per group
+	RowGroupBytes     int64         `yaml:"row_group_bytes"`     // Target uncompressed bytes per group
+	MaxRowsPerFile    int64         `yaml:"max_rows_per_file"`   // Roll to a new file after N rows (0 = single file)
+	MaxBytesPerFile   int64         `yaml:"max_bytes_per_file"`  // Roll to a new file after N written bytes (0 = single file)
+	FilenameTemplate  string        `yaml:"filename_template"`   // Suffix appended to the table name, e.g. "_%04d.parquet"
+	MaxOpenPartitions int           `yaml:"max_open_partitions"` // Cap on open partition writers per table (default 64)
+	RequiredPolicy    string        `yaml:"required_policy"`     // Rows missing a required field: fail (default), skip, dead_letter
+	DeadLetterPath    string        `yaml:"dead_letter_path"`    // NDJSON file for dead-lettered rows, relative to output_path (default dead_letter.ndjson)
 }
 
 // SourceConfig defines the source data
 type SourceConfig struct {
-	Type        string `yaml:"type"`         // Type: file, url, s3
-	Path        string `yaml:"path"`         // Path to source
-	RootArray   string `yaml:"root_array"`   // Root array name if JSON is array at root
-	TypeField   string `yaml:"type_field"`   // Field name that contains entity type (optional)
+	Type        string           `yaml:"type"`        // Type: file, url, s3
+	Path        PathList         `yaml:"path"`        // Path(s) to source: file, directory, glob or a list of them
+	RootArray   string           `yaml:"root_array"`  // Root array name if JSON is array at root
+	Format      string           `yaml:"format"`      // Format: json, ndjson (auto-detected from extension if empty)
+	Compression string           `yaml:"compression"` // Input compression: gzip, zstd, bzip2, xz, none (auto-detected if empty)
+	TypeField   string           `yaml:"type_field"`  // Field name that contains entity type (optional)
+	Provenance  ProvenanceConfig `yaml:"provenance"`  // Provenance columns added to every table
+	S3          S3Config         `yaml:"s3"`          // Connection settings for s3:// sources
+}
+
+// S3Config holds connection settings for S3-compatible object storage.
+// Empty values fall back to the standard AWS environment, shared config and credentials chain.
+type S3Config struct {
+	Region          string `yaml:"region"`            // AWS region (e.g., "us-east-1")
+	Endpoint        string `yaml:"endpoint"`          // Custom endpoint, e.g. "http://localhost:9000" for MinIO
+	ForcePathStyle  bool   `yaml:"force_path_style"`  // Use path-style addressing (required by MinIO)
+	Profile         string `yaml:"profile"`           // Shared config profile
+	AccessKeyID     string `yaml:"access_key_id"`     // Static access key (optional)
+	SecretAccessKey string `yaml:"secret_access_key"` // Static secret key (optional)
+}
+
+// ProvenanceConfig selects the provenance columns injected into every table
+type ProvenanceConfig struct {
+	SourceFile  bool `yaml:"source_file"`         // Add a source_file column with the originating path
+	RecordIndex bool `yaml:"source_record_index"` // Add a source_record_index column with the root record position in its file
+}
+
+// PathList holds one or more source paths. In YAML it accepts either a single string or a list.
+type PathList []string
+
+// UnmarshalYAML decodes a scalar or a sequence of scalars into a PathList
+func (p *PathList) UnmarshalYAML(value *yaml.Node) error {
+	switch value.Kind {
+	case yaml.ScalarNode:
+		var path string
+		if err := value.Decode(&path); err != nil {
+			return err
+		}
+		*p = nil
+		if path != "" {
+			*p = PathList{path}
+		}
+		return nil
+	case yaml.SequenceNode:
+		var paths []string
+		if err := value.Decode(&paths); err != nil {
+			return err
+		}
+		*p = paths
+		return nil
+	default:
+		return fmt.Errorf("line %d: path must be a string or a list of strings", value.Line)
+	}
 }